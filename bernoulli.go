@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// EventModel decides what a training message contributes to the Bows.
+//
+// Multinomial counts every occurrence of a word. Bernoulli only records
+// whether a word occurs in a message, so the Bows hold per-class document
+// frequencies, and scoring a message also counts the vocabulary words it
+// does not contain, each with its (1 - P(word|class)) term. Bernoulli often
+// does better on short messages.
+type EventModel string
+
+const (
+	Multinomial EventModel = "multinomial"
+	Bernoulli   EventModel = "bernoulli"
+)
+
+func parseEventModel(s string) (EventModel, error) {
+	switch model := EventModel(s); model {
+	case Multinomial, Bernoulli:
+		return model, nil
+	default:
+		return "", fmt.Errorf("unknown model %q (want multinomial or bernoulli)", s)
+	}
+}
+
+// bernoulliLikelihood is the smoothed P(word present|class) of a word that
+// occurs in docFreq of the class's docs training messages.
+func (c *Classifier) bernoulliLikelihood(docFreq int, docs int) float64 {
+	return (float64(docFreq) + c.Alpha) / (float64(docs) + 2*c.Alpha)
+}
+
+// presentLogOdds is what a word occurring in a message adds to the class
+// score on top of the absent term already counted by absentLogProbability.
+func (c *Classifier) presentLogOdds(docFreq int, docs int) float64 {
+	p := c.bernoulliLikelihood(docFreq, docs)
+	return math.Log(p) - math.Log1p(-p)
+}
+
+// absentLogProbability is the log-probability, under one class, of a message
+// containing none of the vocabulary words.
+func (c *Classifier) absentLogProbability(bow Bow, docs int) float64 {
+	sum := 0.0
+	for _, word := range c.vocabulary() {
+		sum += math.Log1p(-c.bernoulliLikelihood(bow[word], docs))
+	}
+	return sum
+}
+
+// vocabulary returns the words that occur at least MinWordFreq times across
+// all classes, sorted so that sums over them come out the same every run.
+func (c *Classifier) vocabulary() []string {
+	var words []string
+	c.eachVocabularyWord(func(word string) { words = append(words, word) })
+	sort.Strings(words)
+	return words
+}
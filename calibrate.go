@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+)
+
+// Calibration maps the raw log-odds of a message, spamScore - hamScore, to
+// P(spam) = 1 / (1 + exp(A*logOdds + B)). Naive Bayes treats every word as
+// independent evidence, so its own probabilities pile up at 0 and 1; a
+// Calibration fitted on held-out messages (Platt scaling) turns them back
+// into something a threshold can be tuned on.
+type Calibration struct {
+	A float64
+	B float64
+}
+
+func (cal Calibration) probability(logOdds float64) float64 {
+	return 1 / (1 + math.Exp(cal.A*logOdds+cal.B))
+}
+
+// probability is P(spam) for the two scores, calibrated if c has a
+// Calibration.
+func (c *Classifier) probability(spamScore float64, hamScore float64) float64 {
+	if c.Calibration == nil {
+		return spamProbability(spamScore, hamScore)
+	}
+	return c.Calibration.probability(spamScore - hamScore)
+}
+
+// Calibrate fits c.Calibration to files, labeled messages the classifier was
+// not trained on; fitting it to training messages would only learn how
+// overconfident the model is on what it has already seen. Both labels have
+// to be present.
+func (c *Classifier) Calibrate(files []LabeledFile) error {
+	logOdds := make([]float64, len(files))
+	err := parallelFor(context.Background(), len(files), c.workers(), func(_ int, i int) error {
+		spamScore, hamScore, err := c.ClassifyFile(files[i].Path)
+		if err != nil {
+			return withPath(files[i].Path, err)
+		}
+		logOdds[i] = spamScore - hamScore
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	isSpam := make([]bool, len(files))
+	spam := 0
+	for i, file := range files {
+		isSpam[i] = file.Label == Spam
+		if isSpam[i] {
+			spam++
+		}
+	}
+	if spam == 0 || spam == len(files) {
+		return errors.New("calibration needs both ham and spam messages")
+	}
+
+	calibration := fitPlatt(logOdds, isSpam)
+	c.mu.Lock()
+	c.Calibration = &calibration
+	c.mu.Unlock()
+	return nil
+}
+
+// fitPlatt finds the A and B that maximize the likelihood of the labels,
+// using Newton's method with backtracking as in Lin, Lin and Weng's
+// "A note on Platt's probabilistic outputs for support vector machines".
+// The 0/1 targets are smoothed as Platt suggests so the fit does not chase
+// infinite log-odds on a cleanly separated set.
+func fitPlatt(logOdds []float64, isSpam []bool) Calibration {
+	var spam, ham float64
+	for _, s := range isSpam {
+		if s {
+			spam++
+		} else {
+			ham++
+		}
+	}
+	targets := make([]float64, len(isSpam))
+	for i, s := range isSpam {
+		if s {
+			targets[i] = (spam + 1) / (spam + 2)
+		} else {
+			targets[i] = 1 / (ham + 2)
+		}
+	}
+
+	// objective is the negative log-likelihood, written to never take the
+	// exp of a large positive number.
+	objective := func(cal Calibration) float64 {
+		sum := 0.0
+		for i, f := range logOdds {
+			z := cal.A*f + cal.B
+			if z >= 0 {
+				sum += targets[i]*z + math.Log1p(math.Exp(-z))
+			} else {
+				sum += (targets[i]-1)*z + math.Log1p(math.Exp(z))
+			}
+		}
+		return sum
+	}
+
+	const (
+		maxIterations = 100
+		minStep       = 1e-10
+		sigma         = 1e-12 // keeps the Hessian positive definite
+		epsilon       = 1e-5
+	)
+	cal := Calibration{A: 0, B: math.Log((ham + 1) / (spam + 1))}
+	value := objective(cal)
+	for range maxIterations {
+		h11, h22, h21 := sigma, sigma, 0.0
+		g1, g2 := 0.0, 0.0
+		for i, f := range logOdds {
+			z := cal.A*f + cal.B
+			var p, q float64 // P(spam) and 1 - P(spam)
+			if z >= 0 {
+				p = math.Exp(-z) / (1 + math.Exp(-z))
+				q = 1 / (1 + math.Exp(-z))
+			} else {
+				p = 1 / (1 + math.Exp(z))
+				q = math.Exp(z) / (1 + math.Exp(z))
+			}
+			d2 := p * q
+			h11 += f * f * d2
+			h22 += d2
+			h21 += f * d2
+			d1 := targets[i] - p
+			g1 += f * d1
+			g2 += d1
+		}
+		if math.Abs(g1) < epsilon && math.Abs(g2) < epsilon {
+			break
+		}
+
+		det := h11*h22 - h21*h21
+		dA := -(h22*g1 - h21*g2) / det
+		dB := -(-h21*g1 + h11*g2) / det
+		slope := g1*dA + g2*dB
+
+		step := 1.0
+		for ; step >= minStep; step /= 2 {
+			next := Calibration{A: cal.A + step*dA, B: cal.B + step*dB}
+			if nextValue := objective(next); nextValue < value+1e-4*step*slope {
+				cal, value = next, nextValue
+				break
+			}
+		}
+		if step < minStep {
+			break
+		}
+	}
+	return cal
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// windows1252High maps the bytes 0x80-0x9f of windows-1252, where it differs
+// from ISO-8859-1, to their runes. Unassigned bytes map to U+FFFD.
+var windows1252High = [32]rune{
+	'€', '\ufffd', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '\ufffd', 'Ž', '\ufffd',
+	'\ufffd', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '\ufffd', 'ž', 'Ÿ',
+}
+
+// toUTF8 transcodes text in the given MIME charset to UTF-8. Only the
+// charsets old mail mostly comes in are known: UTF-8 and US-ASCII pass
+// through, ISO-8859-1 and windows-1252 are converted. ok is false for any
+// other charset, in which case text is returned as is.
+func toUTF8(charset string, text []byte) (_ []byte, ok bool) {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return text, true
+	case "iso-8859-1", "iso8859-1", "latin1", "latin-1":
+		return decodeSingleByte(text, false), true
+	case "windows-1252", "cp1252":
+		return decodeSingleByte(text, true), true
+	default:
+		return text, false
+	}
+}
+
+// decodeSingleByte decodes ISO-8859-1, or windows-1252 with windows set.
+func decodeSingleByte(text []byte, windows bool) []byte {
+	decoded := make([]byte, 0, len(text)+len(text)/8)
+	for _, b := range text {
+		r := rune(b)
+		if windows && b >= 0x80 && b < 0xa0 {
+			r = windows1252High[b-0x80]
+		}
+		decoded = utf8.AppendRune(decoded, r)
+	}
+	return decoded
+}
+
+// charsetReader is a mime.WordDecoder CharsetReader for the charsets toUTF8
+// knows, so encoded subjects like =?windows-1252?q?...?= decode too.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	text, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	decoded, ok := toUTF8(charset, text)
+	if !ok {
+		return nil, fmt.Errorf("unsupported charset %q", charset)
+	}
+	return bytes.NewReader(decoded), nil
+}
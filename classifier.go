@@ -0,0 +1,1256 @@
+// Naive Bayes Spam Classifier
+//
+//   P(spam|words) = P(words|spam) * P(spam) / P(words)
+//     posterior    =  likelihood   *  prior  / evidence
+//
+//   prior      — how common spam/ham is overall (spamDocs / totalDocs)
+//   likelihood — probability of seeing these words given it's spam (or ham)
+//   evidence   — probability of seeing these words regardless of class
+//   posterior   — final score: how likely the email is spam (or ham)
+//
+//   The evidence is the same for both classes, so it is never computed:
+//   comparing likelihood * prior decides the label, and spamProbability
+//   normalizes the two into P(spam|words).
+//
+//   We use log() on everything so we can add instead of multiply,
+//   which avoids floating-point underflow with many small probabilities.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type Bow map[string]int
+
+// DefaultMinWordFreq is the MinWordFreq cutoff tuned for the enron corpus.
+const DefaultMinWordFreq = 100
+
+// DefaultSubjectWeight counts subject tokens like body tokens.
+const DefaultSubjectWeight = 1.0
+
+// DefaultBinaryRatio is the default Classifier.BinaryRatio.
+const DefaultBinaryRatio = 0.3
+
+// DefaultMaxFileSize is the default Classifier.MaxFileSize.
+const DefaultMaxFileSize = 10 << 20
+
+// FileErrors collects the training files that could not be read, each error
+// naming its path. Unless FailFast is set, Train and TrainFiles return
+// it after training on all the other files.
+type FileErrors []error
+
+func (e FileErrors) Error() string {
+	return errors.Join(e...).Error()
+}
+
+func (e FileErrors) Unwrap() []error {
+	return e
+}
+
+// SkippedFile is a training file that was left out, with the reason.
+type SkippedFile struct {
+	Path   string
+	Reason string
+}
+
+// DefaultAlpha is the additive (Laplace) smoothing constant.
+const DefaultAlpha = 1.0
+
+// DefaultThreshold labels a message spam once it is more likely spam than not.
+const DefaultThreshold = 0.5
+
+const (
+	Ham  = "ham"
+	Spam = "spam"
+
+	// Unsure is the label of messages too close to Threshold to call; see
+	// UnsureMargin.
+	Unsure = "unsure"
+)
+
+// Classifier holds the per-class word counts learned from training. The
+// classes are Ham and Spam unless it was made with NewMultiClassifier.
+//
+// A Classifier is safe for concurrent use once configured: the Train,
+// AddDocument and Load methods take a write lock, and classification, Save
+// and the inspection methods a read lock. AddDocument reads and tokenizes its
+// message under the read lock too, since Load replaces the tokenizer
+// settings, and only takes the write lock to count it, so a server can keep
+// classifying while it learns from corrections; if a Load got in between, it
+// tokenizes the message again with the new settings. The settings fields are
+// otherwise not guarded and must not be set while the Classifier is shared.
+type Classifier struct {
+	mu sync.RWMutex
+
+	// Bows holds the word counts of each class, keyed by label, and Totals
+	// their sum over the words that pass MinWordFreq.
+	Bows      map[string]Bow
+	Totals    map[string]int
+	VocabSize int
+	Alpha     float64
+
+	// Docs counts the training messages of each class.
+	Docs map[string]int
+
+	// EventModel is Multinomial or Bernoulli; see EventModel.
+	EventModel EventModel
+
+	// Prior is PriorEmpirical or PriorUniform; see Prior. SpamWeight and
+	// HamWeight then scale the prior of each class, so a SpamWeight of 0.5
+	// makes spam half as likely a priori on top of whatever Prior says.
+	Prior      Prior
+	SpamWeight float64
+	HamWeight  float64
+
+	// MinWordFreq is how often a word has to occur in training to be counted
+	// at all; rarer words are ignored by the totals and by scoring.
+	MinWordFreq int
+
+	Tokenizer Tokenizer
+
+	// Tokenize, when set, replaces Tokenizer for training and classification
+	// alike, e.g. to split log lines rather than prose:
+	//
+	//	c := NewClassifier()
+	//	c.Tokenize = func(s string) []string {
+	//		return strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == '=' })
+	//	}
+	//
+	// A function cannot be saved with the model; saved models only record
+	// that one was used, and loading such a model without setting Tokenize
+	// first logs a warning.
+	Tokenize func(string) []string
+
+	// Features are run on every message on top of the tokenizer, and the
+	// feature strings they return are counted alongside its tokens; see
+	// FeatureExtractor. Like Tokenize they cannot be saved with the model,
+	// so set the same Features again before classifying with a loaded one.
+	Features []FeatureExtractor
+
+	// HashBuckets, when positive, counts every token under one of this many
+	// hashed buckets instead of under the token itself (the hashing trick):
+	// the counts of each class move out of the Bows into a slice of
+	// HashBuckets counts, so memory stays fixed however large the corpus.
+	// Tokens that collide share their counts, which blurs the evidence a
+	// little; with DefaultHashBuckets that costs next to nothing, while a
+	// few thousand buckets start to hurt. Inspecting a hashed model shows
+	// bucket names rather than words.
+	HashBuckets int
+
+	// ParseEmail treats every message as RFC 822 / MIME and only tokenizes
+	// its decoded text body instead of the raw bytes.
+	ParseEmail bool
+
+	// SubjectWeight multiplies the counts of tokens from the subject line of
+	// parsed (ParseEmail) messages, in training and classification alike.
+	SubjectWeight float64
+
+	// StripHTML drops tags and decodes entities so only the visible text of
+	// HTML messages is tokenized.
+	StripHTML bool
+
+	// StripQuotes drops quoted reply lines ("> ...") and signatures (from a
+	// "-- " line on) so only the text the sender wrote is tokenized.
+	StripQuotes bool
+
+	// Workers is how many files are read and tokenized in parallel during
+	// training and classification. Zero means runtime.GOMAXPROCS(0).
+	Workers int
+
+	// Extensions limits which files Train and ClassifyDir pick up from a
+	// directory.
+	Extensions ExtFilter
+
+	// BinaryRatio is the share of control or non-UTF-8 bytes in the first
+	// binarySniffLen bytes of a training file above which it is skipped as
+	// binary (see looksBinary); 1 or more keeps every file.
+	BinaryRatio float64
+
+	// MaxFileSize is the size in bytes above which a training file is
+	// skipped rather than read. Zero means no limit.
+	MaxFileSize int64
+
+	// FailFast makes Train and TrainFiles stop at the first file they
+	// cannot read instead of returning FileErrors at the end.
+	FailFast bool
+
+	// Logger receives a debug event per training file, an info summary per
+	// training source, and warnings about files that were skipped or could
+	// not be read. Nil discards everything.
+	Logger *slog.Logger
+
+	// Debug logs every term of a classified message's scores, per word and
+	// class, both as the log-probability that is added up and as the
+	// probability itself, to Logger at debug level. Terms that are -Inf, as
+	// a word unseen in a class gives without smoothing, are logged as
+	// warnings. It slows classification down a lot, so it is meant for
+	// looking into a few messages.
+	Debug bool
+
+	// Skipped lists the training files left out so far and why.
+	Skipped []SkippedFile
+
+	// Dedup trains on byte-identical messages only once, whatever file,
+	// mbox, archive or row they come from, so spam sent a thousand times
+	// does not count a thousand times. Duplicates counts the messages left
+	// out; duplicate files are also listed in Skipped with DuplicateReason.
+	Dedup      bool
+	Duplicates int
+	dedupMu    sync.Mutex
+	seen       map[[sha256.Size]byte]struct{}
+
+	// Threshold is the P(spam) at or above which a message is labeled spam.
+	// It, Calibration and UnsureMargin only apply to the two classes Ham and
+	// Spam; with any other classes the most likely one wins.
+	Threshold float64
+
+	// Calibration, when set, replaces the raw naive Bayes P(spam) in results
+	// and decisions; see Calibrate.
+	Calibration *Calibration
+
+	// UnsureMargin, when positive, labels a message Unsure instead of spam
+	// or ham if its P(spam) is less than this far from Threshold, so
+	// borderline mail can go to a human.
+	UnsureMargin float64
+
+	// DocFreq counts, for every word, the training messages of either class
+	// it occurs in.
+	DocFreq Bow
+
+	// TFIDF weights each word of a classified message by its TF-IDF instead
+	// of counting it once, so words that occur in nearly every training
+	// message carry less weight than rare, discriminative ones.
+	TFIDF bool
+
+	// absent caches, per class, the Bernoulli log-probability of a message
+	// that contains none of the vocabulary.
+	absent map[string]float64
+
+	// loads counts the models loaded into c, which replace the tokenizer
+	// settings; see lockDocument.
+	loads int
+
+	// buckets and bucketDocFreq take the place of the Bows and DocFreq with
+	// HashBuckets set, which then only keep the labels; see bucketsFor.
+	buckets       map[string]buckets
+	bucketDocFreq buckets
+}
+
+func NewClassifier() *Classifier {
+	return NewMultiClassifier(Ham, Spam)
+}
+
+// NewMultiClassifier returns a Classifier that sorts messages into the given
+// classes, e.g. spam, promotions and personal, rather than ham and spam.
+func NewMultiClassifier(labels ...string) *Classifier {
+	c := &Classifier{
+		Bows:          make(map[string]Bow),
+		Totals:        make(map[string]int),
+		Docs:          make(map[string]int),
+		DocFreq:       make(Bow),
+		Alpha:         DefaultAlpha,
+		MinWordFreq:   DefaultMinWordFreq,
+		Tokenizer:     DefaultTokenizer(),
+		Threshold:     DefaultThreshold,
+		BinaryRatio:   DefaultBinaryRatio,
+		MaxFileSize:   DefaultMaxFileSize,
+		SubjectWeight: DefaultSubjectWeight,
+		EventModel:    Multinomial,
+		Prior:         PriorEmpirical,
+		SpamWeight:    1,
+		HamWeight:     1,
+	}
+	for _, label := range labels {
+		c.Bows[label] = make(Bow)
+	}
+	return c
+}
+
+// Labels returns the classes of c in sorted order.
+func (c *Classifier) Labels() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.labels()
+}
+
+func (c *Classifier) labels() []string {
+	labels := make([]string, 0, len(c.Bows))
+	for label := range c.Bows {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// binary reports whether the classes of c are Ham and Spam, which the
+// settings and methods about P(spam) need.
+func (c *Classifier) binary() bool {
+	_, ham := c.Bows[Ham]
+	_, spam := c.Bows[Spam]
+	return ham && spam && len(c.Bows) == 2
+}
+
+// checkBinary fails the methods that only make sense for ham and spam.
+func (c *Classifier) checkBinary() error {
+	if !c.binary() {
+		return fmt.Errorf("model classes %s are not ham and spam", strings.Join(c.labels(), ", "))
+	}
+	return nil
+}
+
+// wordCount is how often word occurs across all classes.
+func (c *Classifier) wordCount(word string) int {
+	count := 0
+	for label := range c.Bows {
+		count += c.counts(label).count(word)
+	}
+	return count
+}
+
+// counts returns the word counts of label, from its Bow or its buckets.
+func (c *Classifier) counts(label string) countStore {
+	if c.HashBuckets > 0 {
+		return c.buckets[label]
+	}
+	return c.Bows[label]
+}
+
+// docFreq returns DocFreq, or its buckets for a hashed model.
+func (c *Classifier) docFreq() countStore {
+	if c.HashBuckets > 0 {
+		return c.bucketDocFreq
+	}
+	return c.DocFreq
+}
+
+// newStore returns empty counts of the kind c keeps, e.g. for a worker to
+// count into.
+func (c *Classifier) newStore() countStore {
+	if c.HashBuckets > 0 {
+		return make(buckets, c.HashBuckets)
+	}
+	return make(Bow)
+}
+
+// Train adds every file under dir to the Bow of the given label, e.g. "ham" or "spam".
+func (c *Classifier) Train(dir string, label string) error {
+	return c.TrainContext(context.Background(), dir, label)
+}
+
+// TrainContext is Train, stopping early with ctx.Err() once ctx is done. The
+// classifier is left without the files of dir in that case.
+func (c *Classifier) TrainContext(ctx context.Context, dir string, label string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bow, err := c.bowFor(label)
+	if err != nil {
+		return err
+	}
+	if err := checkDir("training dir", dir); err != nil {
+		return err
+	}
+
+	paths, err := listFiles(ctx, dir, c.Extensions)
+	if err != nil {
+		return err
+	}
+	added, err := c.addFilesToBow(ctx, paths, bow)
+	var fileErrs FileErrors
+	if err != nil && !errors.As(err, &fileErrs) {
+		return err
+	}
+	if bow.size() == 0 {
+		return fmt.Errorf("training dir %q: no %s words found", dir, label)
+	}
+	c.countDocs(label, added)
+
+	c.updateTotals()
+	c.logger().Info("trained", "dir", dir, "label", label, "files", added, "skipped", len(paths)-added)
+	return err
+}
+
+// TrainFiles adds the given files to the Bow of label.
+func (c *Classifier) TrainFiles(paths []string, label string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bow, err := c.bowFor(label)
+	if err != nil {
+		return err
+	}
+
+	added, err := c.addFilesToBow(context.Background(), paths, bow)
+	var fileErrs FileErrors
+	if err != nil && !errors.As(err, &fileErrs) {
+		return err
+	}
+	if bow.size() == 0 {
+		return fmt.Errorf("no %s words found in %d files", label, len(paths))
+	}
+	c.countDocs(label, added)
+
+	c.updateTotals()
+	return err
+}
+
+// AddDocument adds a single labeled message to an already trained
+// classifier, e.g. to correct a misclassification, without retraining from
+// scratch. The message goes through the same reader and tokenizer settings
+// as the training files.
+func (c *Classifier) AddDocument(text string, label string) error {
+	return c.AddWeightedDocument(text, label, 1)
+}
+
+// AddWeightedDocument is AddDocument for a message that counts weight times,
+// as if it had been added that often, so a user's correction can outweigh
+// the bulk training it contradicts. A weight of 1 is AddDocument.
+func (c *Classifier) AddWeightedDocument(text string, label string, weight int) error {
+	if weight < 1 {
+		return fmt.Errorf("document weight must be at least 1, got %d", weight)
+	}
+	docBow, err := c.lockDocument(text)
+	if err != nil {
+		return err
+	}
+	defer c.mu.Unlock()
+	// Load replaces the Bows, so look the label up only under the lock.
+	bow, err := c.bowFor(label)
+	if err != nil {
+		return err
+	}
+	c.addDocBow(docBow, bow, c.docFreq(), weight)
+	c.countDocs(label, weight)
+
+	c.updateTotals()
+	return nil
+}
+
+// RemoveDocument takes a message added with AddDocument or trained as label
+// back out of the classifier, e.g. before adding it again under the label it
+// should have had. Counts never drop below zero, but removing a message that
+// was never trained in, or under another label, takes away counts that
+// belong to other messages and leaves the model skewed.
+func (c *Classifier) RemoveDocument(text string, label string) error {
+	return c.RemoveWeightedDocument(text, label, 1)
+}
+
+// RemoveWeightedDocument takes a message added with AddWeightedDocument back
+// out; weight must be the one it was added with.
+func (c *Classifier) RemoveWeightedDocument(text string, label string, weight int) error {
+	if weight < 1 {
+		return fmt.Errorf("document weight must be at least 1, got %d", weight)
+	}
+	docBow, err := c.lockDocument(text)
+	if err != nil {
+		return err
+	}
+	defer c.mu.Unlock()
+	bow, err := c.bowFor(label)
+	if err != nil {
+		return err
+	}
+	for word, count := range docBow {
+		if c.EventModel == Bernoulli {
+			count = 1
+		}
+		bow.add(word, -count*weight)
+		c.docFreq().add(word, -weight)
+	}
+	c.Docs[label] = max(c.Docs[label]-weight, 0)
+
+	c.updateTotals()
+	return nil
+}
+
+// lockDocument tokenizes text for AddDocument and RemoveDocument and
+// returns holding the write lock, which the caller must release. The
+// tokenizing happens under the read lock, so classification goes on
+// meanwhile; should a Load replace the tokenizer settings before the write
+// lock is taken, it tokenizes text again, so that the counts never mix the
+// settings of one model with the Bows of another.
+func (c *Classifier) lockDocument(text string) (Bow, error) {
+	for {
+		docBow, loads, err := c.documentBow(text)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		if c.loads == loads {
+			return docBow, nil
+		}
+		c.mu.Unlock()
+	}
+}
+
+// documentBow tokenizes text under the read lock and returns it with the
+// loads it was tokenized after.
+func (c *Classifier) documentBow(text string) (Bow, int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	docBow := make(Bow)
+	if err := c.addReaderToBow(strings.NewReader(text), docBow); err != nil {
+		return nil, 0, err
+	}
+	return docBow, c.loads, nil
+}
+
+// checkTrained guards the scoring math against a class without any counted
+// words, which would otherwise divide by zero and turn every score into NaN.
+func (c *Classifier) checkTrained() error {
+	for _, label := range c.labels() {
+		if c.Totals[label] == 0 {
+			return fmt.Errorf("model has no %s words occurring at least %d times", label, c.MinWordFreq)
+		}
+	}
+	return nil
+}
+
+func (c *Classifier) logger() *slog.Logger {
+	if c.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return c.Logger
+}
+
+// countDocs records that n more training messages of label were read.
+func (c *Classifier) countDocs(label string, n int) {
+	c.Docs[label] += n
+}
+
+// bowFor returns the counts of label to train into. For a hashed model it
+// allocates them on first use, so it needs the write lock.
+func (c *Classifier) bowFor(label string) (countStore, error) {
+	bow, ok := c.Bows[label]
+	if !ok {
+		return nil, fmt.Errorf("unknown label %q", label)
+	}
+	if c.HashBuckets > 0 {
+		return c.bucketsFor(label), nil
+	}
+	return bow, nil
+}
+
+// updateTotals recomputes the values derived from the Bows after they change.
+func (c *Classifier) updateTotals() {
+	if c.HashBuckets > 0 {
+		c.updateBucketTotals()
+		return
+	}
+	for label, bow := range c.Bows {
+		c.Totals[label] = c.totalWordCount(bow)
+	}
+	c.VocabSize = c.vocabularySize()
+	if c.EventModel == Bernoulli {
+		c.absent = make(map[string]float64)
+		for label, bow := range c.Bows {
+			c.absent[label] = c.absentLogProbability(bow, c.Docs[label])
+		}
+	}
+}
+
+// Prune drops the words rarer than MinWordFreq, which scoring ignores anyway,
+// from the Bows and DocFreq and returns how many it dropped. Classification
+// is unchanged, but a word that was pruned and is trained on again later
+// starts counting from zero.
+func (c *Classifier) Prune() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.HashBuckets > 0 {
+		pruned := c.clearBuckets(func(_ int, count int) bool { return count < c.MinWordFreq })
+		c.updateTotals()
+		return pruned
+	}
+	pruned := 0
+	for _, bow := range c.Bows {
+		for word := range bow {
+			if c.wordCount(word) >= c.MinWordFreq {
+				continue
+			}
+			// Deleting from every Bow counts a word seen in several only once.
+			c.deleteWord(word)
+			pruned++
+		}
+	}
+	c.updateTotals()
+	return pruned
+}
+
+// deleteWord drops word from every Bow and from DocFreq.
+func (c *Classifier) deleteWord(word string) {
+	for _, bow := range c.Bows {
+		delete(bow, word)
+	}
+	delete(c.DocFreq, word)
+}
+
+func (c *Classifier) ClassifyFile(path string) (float64, float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0.0, 0.0, err
+	}
+	defer f.Close()
+
+	return c.ClassifyReader(f)
+}
+
+// ClassifyReader scores a single message read from r, e.g. os.Stdin. It
+// needs the classes Ham and Spam; Classify works with any.
+func (c *Classifier) ClassifyReader(r io.Reader) (float64, float64, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	fileBow := make(Bow)
+	if err := c.addReaderToBow(r, fileBow); err != nil {
+		return 0.0, 0.0, err
+	}
+	if err := c.checkBinary(); err != nil {
+		return 0.0, 0.0, err
+	}
+	if err := c.checkTrained(); err != nil {
+		return 0.0, 0.0, err
+	}
+	spamScore, hamScore := c.scoreBow(fileBow)
+	return spamScore, hamScore, nil
+}
+
+// ClassifyText labels a message held in memory and returns the label with
+// its P(spam), or with classes other than Ham and Spam the most likely label
+// with its probability.
+func (c *Classifier) ClassifyText(text string) (string, float64, error) {
+	result, err := c.Classify(strings.NewReader(text))
+	if err != nil {
+		return "", 0.0, err
+	}
+	return result.Label, result.Probability, nil
+}
+
+// scoreBow returns the spam and ham scores of a tokenized message.
+func (c *Classifier) scoreBow(fileBow Bow) (float64, float64) {
+	scores := c.labelScores(fileBow)
+	return scores[Spam], scores[Ham]
+}
+
+// labelScores returns the score of every class for a tokenized message; it
+// is the core every Classify method ends up in.
+//
+// The scores are log(likelihood * prior). Subtracting log P(words) from all
+// of them, as the full Bayes formula would, cannot change which is largest or
+// the probabilities derived from them. Bernoulli scores start from the
+// probability of a message without any vocabulary word, which the words
+// present then correct.
+func (c *Classifier) labelScores(fileBow Bow) map[string]float64 {
+	priors := c.priors()
+	scores := make(map[string]float64, len(c.Bows))
+	if c.EventModel == Bernoulli {
+		for label := range c.Bows {
+			scores[label] = math.Log(priors[label]) + c.absent[label]
+		}
+	}
+	labels := c.labels()
+	for _, word := range sortedWords(fileBow) {
+		if c.wordCount(word) < c.MinWordFreq {
+			continue
+		}
+		weight := c.termWeight(word, fileBow[word])
+		for _, label := range labels {
+			logLikelihood := c.logLikelihood(word, label)
+			if c.Debug {
+				c.debugTerm("word", word, label, logLikelihood)
+			}
+			scores[label] += weight * logLikelihood
+		}
+	}
+	if c.EventModel != Bernoulli {
+		for label := range c.Bows {
+			scores[label] += math.Log(priors[label])
+		}
+	}
+	if c.Debug {
+		for _, label := range labels {
+			c.debugTerm("prior", "", label, math.Log(priors[label]))
+		}
+	}
+	return scores
+}
+
+// debugTerm logs one log-probability term of a score for Debug, along with
+// its exponent so the actual probability (for Bernoulli words, the odds
+// ratio) can be read off, and warns if it is -Inf and so rules out label
+// for every message.
+func (c *Classifier) debugTerm(kind string, word string, label string, logP float64) {
+	if math.IsInf(logP, -1) {
+		c.logger().Warn("term underflowed to -Inf; is smoothing off?", "term", kind, "word", word, "class", label)
+		return
+	}
+	c.logger().Debug("score term", "term", kind, "word", word, "class", label, "log", logP, "exp", math.Exp(logP))
+}
+
+// priors returns the prior probability of every class as Prior, SpamWeight
+// and HamWeight say. Empirical priors come from the number of training
+// messages of each class; models saved before documents were counted fall
+// back to the word totals. The scores add the log of these, so a weight
+// moves the decision boundary by log(SpamWeight/HamWeight) whatever the
+// message.
+func (c *Classifier) priors() map[string]float64 {
+	labels := c.labels()
+	counts := c.Docs
+	for _, label := range labels {
+		if c.Docs[label] == 0 {
+			counts = c.Totals
+			break
+		}
+	}
+
+	priors := make(map[string]float64, len(labels))
+	total := 0.0
+	for _, label := range labels {
+		prior := 1.0
+		if c.Prior != PriorUniform {
+			prior = float64(counts[label])
+		}
+		prior *= c.classWeight(label)
+		priors[label] = prior
+		total += prior
+	}
+	for label := range priors {
+		priors[label] /= total
+	}
+	return priors
+}
+
+// classWeight is SpamWeight for Spam, HamWeight for Ham and 1 otherwise.
+func (c *Classifier) classWeight(label string) float64 {
+	switch label {
+	case Spam:
+		return c.SpamWeight
+	case Ham:
+		return c.HamWeight
+	default:
+		return 1
+	}
+}
+
+// logLikelihood is the smoothed log-likelihood of word under the class label
+// (for Bernoulli, the log-odds of the word being present).
+func (c *Classifier) logLikelihood(word string, label string) float64 {
+	if c.EventModel == Bernoulli {
+		return c.presentLogOdds(c.counts(label).count(word), c.Docs[label])
+	}
+	return math.Log(smoothedLikelihood(c.counts(label).count(word), c.Totals[label], c.VocabSize, c.Alpha))
+}
+
+// eachScoredWord calls fn for every word of fileBow that passes MinWordFreq,
+// with the word's termWeight and its logLikelihood under spam and ham. Words
+// come in sorted order so that sums over them are reproducible.
+func (c *Classifier) eachScoredWord(fileBow Bow, fn func(word string, weight float64, logSpam float64, logHam float64)) {
+	for _, word := range sortedWords(fileBow) {
+		if c.wordCount(word) < c.MinWordFreq {
+			continue
+		}
+		fn(word, c.termWeight(word, fileBow[word]), c.logLikelihood(word, Spam), c.logLikelihood(word, Ham))
+	}
+}
+
+// termWeight is how much a word occurring count times in a classified
+// message counts towards its score: once without TF-IDF, otherwise its
+// sublinear term frequency times the smoothed inverse document frequency.
+func (c *Classifier) termWeight(word string, count int) float64 {
+	docs := 0
+	for _, n := range c.Docs {
+		docs += n
+	}
+	if !c.TFIDF || docs == 0 {
+		return 1.0
+	}
+	tf := 1 + math.Log(float64(count))
+	idf := math.Log(float64(1+docs)/float64(1+c.docFreq().count(word))) + 1
+	return tf * idf
+}
+
+// Result is the classification of a single message: its Label under the
+// configured Threshold, P(spam) as Probability, and the raw log scores it was
+// derived from. With classes other than Ham and Spam, Label is the most
+// likely class, Probability its probability and Scores holds the log score
+// of every class instead.
+type Result struct {
+	Label       string             `json:"label"`
+	Probability float64            `json:"pSpam"`
+	SpamScore   float64            `json:"spamScore"`
+	HamScore    float64            `json:"hamScore"`
+	Scores      map[string]float64 `json:"scores,omitempty"`
+
+	// Matched counts the tokens of the message the model scored, Ignored
+	// those it does not know or that fall below MinWordFreq, and Coverage
+	// is the share of Matched. A message without coverage is labeled by the
+	// priors alone.
+	Matched  int     `json:"matchedTokens"`
+	Ignored  int     `json:"ignoredTokens"`
+	Coverage float64 `json:"coverage"`
+}
+
+// FileResult is the Result of the message at Path.
+type FileResult struct {
+	Path string `json:"path"`
+	Result
+}
+
+func (c *Classifier) result(spamScore float64, hamScore float64) Result {
+	return Result{
+		Label:       c.label(spamScore, hamScore),
+		Probability: c.probability(spamScore, hamScore),
+		SpamScore:   spamScore,
+		HamScore:    hamScore,
+	}
+}
+
+// labelResult picks the class with the highest score. Its probability is
+// the softmax of the scores, computed relative to the best one so that the
+// exponentials cannot overflow.
+func labelResult(scores map[string]float64) Result {
+	best := ""
+	for label, score := range scores {
+		if best == "" || score > scores[best] || (score == scores[best] && label < best) {
+			best = label
+		}
+	}
+	sum := 0.0
+	for _, score := range scores {
+		sum += math.Exp(score - scores[best])
+	}
+	return Result{Label: best, Probability: 1 / sum, Scores: scores}
+}
+
+// Classify labels the message read from r.
+func (c *Classifier) Classify(r io.Reader) (Result, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	fileBow := make(Bow)
+	if err := c.addReaderToBow(r, fileBow); err != nil {
+		return Result{}, err
+	}
+	if err := c.checkTrained(); err != nil {
+		return Result{}, err
+	}
+	var result Result
+	if !c.binary() {
+		result = labelResult(c.labelScores(fileBow))
+	} else {
+		result = c.result(c.scoreBow(fileBow))
+	}
+	result.Matched, result.Ignored = c.coverage(fileBow)
+	if tokens := result.Matched + result.Ignored; tokens > 0 {
+		result.Coverage = float64(result.Matched) / float64(tokens)
+	}
+	return result, nil
+}
+
+// coverage counts the tokens of fileBow whose word passes MinWordFreq, and
+// so is scored, and those that are ignored.
+func (c *Classifier) coverage(fileBow Bow) (int, int) {
+	matched, ignored := 0, 0
+	for word, count := range fileBow {
+		if c.wordCount(word) >= c.MinWordFreq {
+			matched += count
+		} else {
+			ignored += count
+		}
+	}
+	return matched, ignored
+}
+
+// classifyPath is Classify on the file at path.
+func (c *Classifier) classifyPath(path string) (Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Result{}, err
+	}
+	defer f.Close()
+
+	return c.Classify(f)
+}
+
+// ClassifyDirResults classifies every file under dirPath, Workers files at a
+// time, and returns the results in lexical path order.
+func (c *Classifier) ClassifyDirResults(dirPath string) ([]FileResult, error) {
+	return c.ClassifyDirResultsContext(context.Background(), dirPath)
+}
+
+// ClassifyDirResultsContext is ClassifyDirResults, stopping early with
+// ctx.Err() once ctx is done.
+func (c *Classifier) ClassifyDirResultsContext(ctx context.Context, dirPath string) ([]FileResult, error) {
+	if err := checkDir("classify dir", dirPath); err != nil {
+		return nil, err
+	}
+
+	paths, err := listFiles(ctx, dirPath, c.Extensions)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]FileResult, len(paths))
+	err = parallelFor(ctx, len(paths), c.workers(), func(_ int, i int) error {
+		result, err := c.classifyPath(paths[i])
+		if err != nil {
+			return withPath(paths[i], err)
+		}
+		results[i] = FileResult{Path: paths[i], Result: result}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ClassifyDir classifies every file under dirPath and returns how many were
+// labeled spam and ham. Files labeled Unsure count as neither.
+func (c *Classifier) ClassifyDir(dirPath string) (int, int, error) {
+	return c.ClassifyDirContext(context.Background(), dirPath)
+}
+
+// ClassifyDirContext is ClassifyDir, stopping early with ctx.Err() once ctx is
+// done.
+func (c *Classifier) ClassifyDirContext(ctx context.Context, dirPath string) (int, int, error) {
+	results, err := c.ClassifyDirResultsContext(ctx, dirPath)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	spamCount := 0
+	hamCount := 0
+	for _, result := range results {
+		switch result.Label {
+		case Spam:
+			spamCount++
+		case Ham:
+			hamCount++
+		}
+	}
+	return spamCount, hamCount, nil
+}
+
+// addFileToBow adds the training file at path to bow and docFreq. It returns
+// why the file was skipped instead, if it was.
+func (c *Classifier) addFileToBow(path string, bow countStore, docFreq countStore) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if c.MaxFileSize > 0 {
+		info, err := f.Stat()
+		if err != nil {
+			return "", err
+		}
+		if info.Size() > c.MaxFileSize {
+			return fmt.Sprintf("%d bytes is over the %d byte limit", info.Size(), c.MaxFileSize), nil
+		}
+	}
+
+	r, err := decompress(f)
+	if err != nil {
+		return "", err
+	}
+	if c.BinaryRatio < 1 {
+		buffered := bufio.NewReaderSize(r, binarySniffLen)
+		head, err := buffered.Peek(binarySniffLen)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if looksBinary(head, c.BinaryRatio) {
+			return "looks binary", nil
+		}
+		r = buffered
+	}
+	added, err := c.addTrainingReader(r, bow, docFreq)
+	if err == nil && !added {
+		return DuplicateReason, nil
+	}
+	return "", err
+}
+
+// addTrainingReader adds one training message to bow and counts each of its
+// words once in docFreq. The Bernoulli model counts each word at most once
+// per message in bow as well. It reports false, adding nothing, for a
+// message Dedup leaves out.
+func (c *Classifier) addTrainingReader(r io.Reader, bow countStore, docFreq countStore) (bool, error) {
+	if c.Dedup {
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return false, err
+		}
+		if c.seenBefore(content) {
+			return false, nil
+		}
+		r = bytes.NewReader(content)
+	}
+
+	docBow := make(Bow)
+	if err := c.addReaderToBow(r, docBow); err != nil {
+		return false, err
+	}
+	c.addDocBow(docBow, bow, docFreq, 1)
+	return true, nil
+}
+
+// addDocBow merges the tokens of one training message, counted weight
+// times, into bow and docFreq.
+func (c *Classifier) addDocBow(docBow Bow, bow countStore, docFreq countStore, weight int) {
+	for word, count := range docBow {
+		if c.EventModel == Bernoulli {
+			count = 1
+		}
+		bow.add(word, count*weight)
+		docFreq.add(word, weight)
+	}
+}
+
+// addReaderToBow counts the tokens of the message read from r into bow. For
+// a hashed model, tokens that share a bucket are folded into one.
+func (c *Classifier) addReaderToBow(r io.Reader, bow Bow) error {
+	if err := c.countTokens(r, bow); err != nil {
+		return err
+	}
+	if c.HashBuckets > 0 {
+		foldBuckets(bow, c.HashBuckets)
+	}
+	return nil
+}
+
+func (c *Classifier) countTokens(r io.Reader, bow Bow) error {
+	r, err := decompress(r)
+	if err != nil {
+		return err
+	}
+	r, err = skipBOM(r)
+	if err != nil {
+		return err
+	}
+
+	if !c.ParseEmail && !c.StripHTML && !c.StripQuotes && c.Tokenize == nil && len(c.Features) == 0 {
+		// Nothing needs the whole message at once, so don't read it in.
+		return c.Tokenizer.TokenizeReader(r, func(token string) {
+			bow[token] += 1
+		})
+	}
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	for _, extractor := range c.Features {
+		for _, feature := range extractor.Extract(content) {
+			bow[feature] += 1
+		}
+	}
+
+	var subject string
+	if c.ParseEmail {
+		if c.SubjectWeight == 1 {
+			content = extractEmailText(content)
+		} else {
+			subject, content = extractEmailParts(content)
+		}
+	}
+	if c.StripHTML {
+		content = stripHTML(content)
+	}
+	if c.StripQuotes {
+		content = stripQuotes(content)
+	}
+
+	for _, token := range c.tokenize(string(content)) {
+		bow[token] += 1
+	}
+	c.addSubjectToBow(subject, bow)
+
+	return nil
+}
+
+func (c *Classifier) tokenize(text string) []string {
+	if c.Tokenize != nil {
+		return c.Tokenize(text)
+	}
+	return c.Tokenizer.Tokenize(text)
+}
+
+// addSubjectToBow counts the tokens of subject SubjectWeight times each,
+// rounded to whole counts.
+func (c *Classifier) addSubjectToBow(subject string, bow Bow) {
+	subjectBow := make(Bow)
+	for _, token := range c.tokenize(subject) {
+		subjectBow[token]++
+	}
+	for token, count := range subjectBow {
+		if weighted := int(math.Round(float64(count) * c.SubjectWeight)); weighted > 0 {
+			bow[token] += weighted
+		}
+	}
+}
+
+func (c *Classifier) workers() int {
+	if c.Workers > 0 {
+		return c.Workers
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// addFilesToBow tokenizes paths into bow using a pool of workers. Each worker
+// counts into a Bow of its own, and those are merged at the end, so there is
+// no locking per token.
+func (c *Classifier) addFilesToBow(ctx context.Context, paths []string, bow countStore) (int, error) {
+	workerBows := make([]countStore, c.workers())
+	workerDocFreqs := make([]countStore, len(workerBows))
+	workerSkipped := make([][]SkippedFile, len(workerBows))
+	workerErrs := make([]FileErrors, len(workerBows))
+	for i := range workerBows {
+		workerBows[i] = c.newStore()
+		workerDocFreqs[i] = c.newStore()
+	}
+
+	err := parallelFor(ctx, len(paths), len(workerBows), func(worker int, i int) error {
+		reason, err := c.addFileToBow(paths[i], workerBows[worker], workerDocFreqs[worker])
+		switch {
+		case reason == DuplicateReason:
+			// Asked for with Dedup, so not worth a warning.
+			c.logger().Debug("skipped file", "path", paths[i], "reason", reason)
+			workerSkipped[worker] = append(workerSkipped[worker], SkippedFile{Path: paths[i], Reason: reason})
+		case reason != "":
+			c.logger().Warn("skipped file", "path", paths[i], "reason", reason)
+			workerSkipped[worker] = append(workerSkipped[worker], SkippedFile{Path: paths[i], Reason: reason})
+		case err == nil:
+			c.logger().Debug("processed file", "path", paths[i])
+		case !c.FailFast && ctx.Err() == nil:
+			c.logger().Warn("unreadable file", "path", paths[i], "err", err)
+			workerErrs[worker] = append(workerErrs[worker], withPath(paths[i], err))
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for i, workerBow := range workerBows {
+		bow.merge(workerBow)
+		c.docFreq().merge(workerDocFreqs[i])
+	}
+
+	var skipped []SkippedFile
+	var errs FileErrors
+	for i := range workerBows {
+		skipped = append(skipped, workerSkipped[i]...)
+		errs = append(errs, workerErrs[i]...)
+	}
+	sort.Slice(skipped, func(i, j int) bool { return skipped[i].Path < skipped[j].Path })
+	c.Skipped = append(c.Skipped, skipped...)
+	added := len(paths) - len(skipped) - len(errs)
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+		return added, errs
+	}
+	return added, nil
+}
+
+// label is Unsure when the spam probability is within UnsureMargin of the
+// Threshold, and Spam or Ham depending on isSpam otherwise. Models with other
+// classes than spam and ham are labelled by labelResult instead.
+func (c *Classifier) label(spamScore float64, hamScore float64) string {
+	if math.Abs(c.probability(spamScore, hamScore)-c.Threshold) < c.UnsureMargin {
+		return Unsure
+	}
+	if c.isSpam(spamScore, hamScore) {
+		return Spam
+	}
+	return Ham
+}
+
+// isSpam applies the decision threshold to the scores from ClassifyFile.
+func (c *Classifier) isSpam(spamScore float64, hamScore float64) bool {
+	return c.probability(spamScore, hamScore) >= c.Threshold
+}
+
+// spamProbability turns the two log scores from ClassifyFile into P(spam) in [0,1].
+// The larger score is subtracted before exponentiating (log-sum-exp) so very
+// negative scores don't underflow to 0/0.
+func spamProbability(spamScore float64, hamScore float64) float64 {
+	maxScore := math.Max(spamScore, hamScore)
+	spam := math.Exp(spamScore - maxScore)
+	ham := math.Exp(hamScore - maxScore)
+	return spam / (spam + ham)
+}
+
+// smoothedLikelihood estimates P(word|class) with additive smoothing, so a word
+// never seen in a class still gets a small non-zero probability instead of log(0).
+func smoothedLikelihood(count int, classTotal int, vocabSize int, alpha float64) float64 {
+	return (float64(count) + alpha) / (float64(classTotal) + alpha*float64(vocabSize))
+}
+
+// sortedWords returns the words of bow in sorted order.
+func sortedWords(bow Bow) []string {
+	words := make([]string, 0, len(bow))
+	for word := range bow {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
+
+// totalWordCount sums the counts in bow of the words that pass MinWordFreq,
+// which like scoring goes by a word's count across all classes. Counting the
+// same words as the numerators of the likelihoods is what makes every class's
+// smoothed likelihoods over the vocabulary sum to 1.
+func (c *Classifier) totalWordCount(bow Bow) int {
+	count := 0
+	for word, n := range bow {
+		if c.wordCount(word) >= c.MinWordFreq {
+			count += n
+		}
+	}
+	return count
+}
+
+// vocabularySize counts the distinct words that pass the MinWordFreq cutoff,
+// i.e. the words ClassifyFile actually scores.
+func (c *Classifier) vocabularySize() int {
+	size := 0
+	c.eachVocabularyWord(func(string) { size++ })
+	return size
+}
+
+// eachVocabularyWord calls fn once for every word that passes MinWordFreq,
+// in no particular order.
+func (c *Classifier) eachVocabularyWord(fn func(word string)) {
+	labels := c.labels()
+	for i, label := range labels {
+	words:
+		for word := range c.Bows[label] {
+			// Words also in an earlier class were visited with it.
+			for _, earlier := range labels[:i] {
+				if _, ok := c.Bows[earlier][word]; ok {
+					continue words
+				}
+			}
+			if c.wordCount(word) >= c.MinWordFreq {
+				fn(word)
+			}
+		}
+	}
+}
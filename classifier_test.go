@@ -0,0 +1,812 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// trainingDocs is a tiny corpus small enough to reason about by hand.
+var trainingDocs = []struct {
+	text  string
+	label string
+}{
+	{"win free money now", Spam},
+	{"free offer click here", Spam},
+	{"cheap pills free shipping", Spam},
+	{"meeting notes for tomorrow", Ham},
+	{"lunch tomorrow with the team", Ham},
+	{"project status and meeting agenda", Ham},
+}
+
+// trainedClassifier returns a Classifier trained on trainingDocs that counts
+// every word, however rare.
+func trainedClassifier(t testing.TB) *Classifier {
+	t.Helper()
+	c := NewClassifier()
+	c.MinWordFreq = 1
+	for _, doc := range trainingDocs {
+		if err := c.AddDocument(doc.text, doc.label); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+// TestConcurrentUse is meant for go test -race: it learns, unlearns,
+// classifies and reloads the same Classifier from several goroutines.
+func TestConcurrentUse(t *testing.T) {
+	c := trainedClassifier(t)
+	var saved bytes.Buffer
+	if err := c.SaveGob(&saved); err != nil {
+		t.Fatal(err)
+	}
+
+	const rounds = 100
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	run := func(fn func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range rounds {
+				if err := fn(); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	for range 4 {
+		run(func() error { return c.AddDocument("free money for the team", Spam) })
+		run(func() error { return c.RemoveDocument("free money for the team", Spam) })
+		run(func() error {
+			_, _, err := c.ClassifyText("free meeting tomorrow")
+			return err
+		})
+		run(func() error {
+			_, err := c.WordStats("FREE")
+			return err
+		})
+	}
+	run(func() error { return c.LoadGob(bytes.NewReader(saved.Bytes())) })
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// TestAddDocumentDuringLoad learns while models with different casing are
+// loaded: every word counted must come out of the tokenizer of the model it
+// is counted in, never the one loaded just before.
+func TestAddDocumentDuringLoad(t *testing.T) {
+	models := make([][]byte, 0, 2)
+	for _, casing := range []Casing{CaseLower, CaseUpper} {
+		c := NewClassifier()
+		c.MinWordFreq = 1
+		c.Tokenizer.Casing = casing
+		for _, doc := range trainingDocs {
+			if err := c.AddDocument(doc.text, doc.label); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var saved bytes.Buffer
+		if err := c.SaveGob(&saved); err != nil {
+			t.Fatal(err)
+		}
+		models = append(models, saved.Bytes())
+	}
+
+	c := NewClassifier()
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		for i := range 200 {
+			if err := c.LoadGob(bytes.NewReader(models[i%2])); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	})
+	for range 4 {
+		wg.Go(func() {
+			for range 200 {
+				if err := c.AddDocument("Free Money", Spam); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	fold := strings.ToLower
+	if c.Tokenizer.Casing == CaseUpper {
+		fold = strings.ToUpper
+	}
+	for _, label := range c.Labels() {
+		for word := range c.Bows[label] {
+			if fold(word) != word {
+				t.Errorf("%s word %q does not have the %s casing of the loaded model", label, word, c.Tokenizer.Casing)
+			}
+		}
+	}
+}
+
+// enronClassifier returns a Classifier trained on data/enron1.
+func enronClassifier(b *testing.B) *Classifier {
+	b.Helper()
+	c := NewClassifier()
+	if err := c.TrainCorpus("data/enron1", DefaultCorpusLayout); err != nil {
+		b.Fatal(err)
+	}
+	return c
+}
+
+func BenchmarkClassifyFile(b *testing.B) {
+	c := enronClassifier(b)
+
+	// The large message is a few MB of enron text, to show what reading a
+	// message whole costs compared to streaming it.
+	sample, err := os.ReadFile(sampleMessage)
+	if err != nil {
+		b.Fatal(err)
+	}
+	large := filepath.Join(b.TempDir(), "large.txt")
+	if err := os.WriteFile(large, []byte(strings.Repeat(string(sample), 4096)), 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, bench := range []struct {
+		name       string
+		path       string
+		parseEmail bool
+	}{
+		{"message", sampleMessage, false},
+		{"large", large, false},
+		{"large-eml", large, true},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			c.ParseEmail = bench.parseEmail
+			info, err := os.Stat(bench.path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(info.Size())
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, _, err := c.ClassifyFile(bench.path); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkTrainDir(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		c := NewClassifier()
+		if err := c.Train("data/enron1/spam", Spam); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkCountStore counts the tokens of a message straight into a Bow and
+// through the countStore interface that training uses, to show what the
+// indirection a disk-backed store would plug into costs.
+func BenchmarkCountStore(b *testing.B) {
+	c := NewClassifier()
+	f, err := os.Open(sampleMessage)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	docBow := make(Bow)
+	if err := c.addReaderToBow(f, docBow); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("map", func(b *testing.B) {
+		b.ReportAllocs()
+		bow, docFreq := make(Bow), make(Bow)
+		for b.Loop() {
+			for word, count := range docBow {
+				bow[word] += count
+				docFreq[word]++
+			}
+		}
+	})
+	b.Run("countStore", func(b *testing.B) {
+		b.ReportAllocs()
+		bow, docFreq := make(Bow), make(Bow)
+		for b.Loop() {
+			c.addDocBow(docBow, bow, docFreq, 1)
+		}
+	})
+}
+
+// checkTotals fails t unless the Totals of c count what its Bows hold.
+func checkTotals(t *testing.T, c *Classifier) {
+	t.Helper()
+	for label, bow := range c.Bows {
+		if got, want := c.Totals[label], c.totalWordCount(bow); got != want {
+			t.Errorf("%s total is %d, but its Bow holds %d words", label, got, want)
+		}
+	}
+}
+
+// writeFile writes content to a file named name in a new temporary
+// directory and returns its path.
+func writeFile(t testing.TB, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPriorFlipsDecision(t *testing.T) {
+	// Nine spam messages against one ham: "bbb" alone is ham by a likelihood
+	// ratio of 8.25, which the prior odds of 9 just outweigh.
+	c := NewClassifier()
+	c.MinWordFreq = 1
+	for range 9 {
+		if err := c.AddDocument("aaa", Spam); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.AddDocument("bbb bbb", Ham); err != nil {
+		t.Fatal(err)
+	}
+
+	label, _, err := c.ClassifyText("bbb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label != Spam {
+		t.Errorf("with the empirical prior, bbb is %s, want spam", label)
+	}
+	c.Prior = PriorUniform
+	label, _, err = c.ClassifyText("bbb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label != Ham {
+		t.Errorf("with a uniform prior, bbb is %s, want ham", label)
+	}
+}
+
+func TestParallelTrainingMatchesSequential(t *testing.T) {
+	train := func(workers int) *Classifier {
+		c := NewClassifier()
+		c.Workers = workers
+		for _, label := range []string{Ham, Spam} {
+			if err := c.Train(filepath.Join("data/enron1", label), label); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return c
+	}
+	sequential, parallel := train(1), train(8)
+	for _, label := range []string{Ham, Spam} {
+		if !maps.Equal(sequential.Bows[label], parallel.Bows[label]) {
+			t.Errorf("%s counts differ between 1 and 8 workers", label)
+		}
+	}
+	if !maps.Equal(sequential.DocFreq, parallel.DocFreq) {
+		t.Error("document frequencies differ between 1 and 8 workers")
+	}
+	if !maps.Equal(sequential.Docs, parallel.Docs) || !maps.Equal(sequential.Totals, parallel.Totals) {
+		t.Errorf("1 worker counted %v docs and %v words, 8 workers %v and %v",
+			sequential.Docs, sequential.Totals, parallel.Docs, parallel.Totals)
+	}
+}
+
+func TestEmptyClassIsAnError(t *testing.T) {
+	c := NewClassifier()
+	if err := c.Train("data/enron1/ham", Ham); err != nil {
+		t.Fatal(err)
+	}
+	err := c.Train(t.TempDir(), Spam)
+	if err == nil || !strings.Contains(err.Error(), "no spam words") {
+		t.Errorf("training on an empty spam dir = %v, want an error saying there are no spam words", err)
+	}
+
+	// Without spam words the model refuses to score rather than return NaN.
+	spamScore, hamScore, err := c.ClassifyReader(strings.NewReader("free money"))
+	if err == nil || !strings.Contains(err.Error(), "no spam words") {
+		t.Errorf("ClassifyReader = %v, %v, %v; want an error saying there are no spam words", spamScore, hamScore, err)
+	}
+}
+
+func TestPriorCountsDocuments(t *testing.T) {
+	// Three short spams against one long ham: by documents spam is three
+	// times as likely, by words thirty times less.
+	c := NewClassifier()
+	c.MinWordFreq = 1
+	for range 3 {
+		if err := c.AddDocument("free money", Spam); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.AddDocument(strings.Repeat("meeting notes agenda ", 60), Ham); err != nil {
+		t.Fatal(err)
+	}
+	if prior := c.priors()[Spam]; math.Abs(prior-0.75) > 1e-12 {
+		t.Errorf("spam prior is %v, want 0.75 from the document counts", prior)
+	}
+
+	// Words the model has never seen leave only the prior to decide.
+	label, _, err := c.ClassifyText("unseen words only")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label != Spam {
+		t.Errorf("a message of unseen words is %s, want spam", label)
+	}
+}
+
+func TestDecisionWithoutEvidence(t *testing.T) {
+	// Scores leave out log P(words), which is the same for both classes: the
+	// label has to follow from comparing them, and the probability has to be
+	// what normalizing by the evidence would give.
+	c := trainedClassifier(t)
+	for _, message := range []string{"free money now", "meeting tomorrow", "free meeting", "cheap lunch offer for the team"} {
+		spamScore, hamScore, err := c.ClassifyReader(strings.NewReader(message))
+		if err != nil {
+			t.Fatal(err)
+		}
+		evidence := math.Log(math.Exp(spamScore) + math.Exp(hamScore))
+		if p, want := spamProbability(spamScore, hamScore), math.Exp(spamScore-evidence); math.Abs(p-want) > 1e-12 {
+			t.Errorf("%q: P(spam) is %v, want %v", message, p, want)
+		}
+		if got, want := c.isSpam(spamScore, hamScore), spamScore >= hamScore; got != want {
+			t.Errorf("%q: isSpam is %v with scores %v and %v", message, got, spamScore, hamScore)
+		}
+	}
+
+	// Long messages have scores whose exponents underflow.
+	if p, want := spamProbability(-2000, -2001), 1/(1+math.Exp(-1)); math.Abs(p-want) > 1e-12 {
+		t.Errorf("P(spam) of scores -2000 and -2001 is %v, want %v", p, want)
+	}
+}
+
+// cancelHandler is a slog.Handler that calls cancel on the first record, to
+// cancel a walk from inside it.
+type cancelHandler struct {
+	cancel context.CancelFunc
+}
+
+func (h cancelHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h cancelHandler) Handle(context.Context, slog.Record) error {
+	h.cancel()
+	return nil
+}
+func (h cancelHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h cancelHandler) WithGroup(string) slog.Handler      { return h }
+
+func TestCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := NewClassifier()
+	c.Workers = 1
+	// The first file trained logs, which cancels the rest of the walk.
+	c.Logger = slog.New(cancelHandler{cancel})
+	if err := c.TrainContext(ctx, "data/enron1/spam", Spam); !errors.Is(err, context.Canceled) {
+		t.Errorf("TrainContext = %v, want %v", err, context.Canceled)
+	}
+	if c.Docs[Spam] != 0 || len(c.Bows[Spam]) != 0 {
+		t.Errorf("cancelled training left %d documents of %d words", c.Docs[Spam], len(c.Bows[Spam]))
+	}
+
+	trained := trainedClassifier(t)
+	if _, _, err := trained.ClassifyDirContext(ctx, "data/enron1/ham"); !errors.Is(err, context.Canceled) {
+		t.Errorf("ClassifyDirContext = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestClassifyDirReportsUnreadableFiles(t *testing.T) {
+	// A dangling symlink cannot be opened, whoever runs the test; root
+	// would read a file without permissions all the same.
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("free money"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "b.txt")
+	if err := os.Symlink(filepath.Join(dir, "gone"), missing); err != nil {
+		t.Fatal(err)
+	}
+
+	c := trainedClassifier(t)
+	if _, _, err := c.ClassifyDir(dir); err == nil || !strings.Contains(err.Error(), missing) {
+		t.Errorf("ClassifyDir = %v, want an error naming %s", err, missing)
+	}
+}
+
+func TestImbalancedPrior(t *testing.T) {
+	// Ten times as much spam as ham tips a message that leans ham over.
+	c := NewClassifier()
+	c.MinWordFreq = 1
+	for _, doc := range trainingDocs {
+		copies := 1
+		if doc.label == Spam {
+			copies = 10
+		}
+		for range copies {
+			if err := c.AddDocument(doc.text, doc.label); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	classify := func(message string) (string, float64) {
+		t.Helper()
+		label, p, err := c.ClassifyText(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return label, p
+	}
+
+	if label, _ := classify("money tomorrow"); label != Spam {
+		t.Errorf("with the empirical prior, money tomorrow is %s, want spam", label)
+	}
+	c.Prior = PriorUniform
+	uniformLabel, uniformP := classify("money tomorrow")
+	if uniformLabel != Ham {
+		t.Errorf("with a uniform prior, money tomorrow is %s, want ham", uniformLabel)
+	}
+	if label, _ := classify("free money tomorrow"); label != Spam {
+		t.Errorf("with a uniform prior, free money tomorrow is %s, want spam", label)
+	}
+
+	// Weighting spam by the inverse of its share is the uniform prior again.
+	c.Prior = PriorEmpirical
+	c.SpamWeight = 0.1
+	if label, p := classify("money tomorrow"); label != Ham || math.Abs(p-uniformP) > 1e-12 {
+		t.Errorf("with SpamWeight 0.1, money tomorrow is %s at %v, want ham at %v", label, p, uniformP)
+	}
+}
+
+// sameCounts fails t unless a and b hold the same counts.
+func sameCounts(t *testing.T, a *Classifier, b *Classifier) {
+	t.Helper()
+	for label, bow := range b.Bows {
+		if !maps.Equal(a.Bows[label], bow) {
+			t.Errorf("%s counts are %v, want %v", label, a.Bows[label], bow)
+		}
+	}
+	if !maps.Equal(a.DocFreq, b.DocFreq) || !maps.Equal(a.Docs, b.Docs) || !maps.Equal(a.Totals, b.Totals) {
+		t.Errorf("model counts %v docs and %v words, want %v and %v", a.Docs, a.Totals, b.Docs, b.Totals)
+	}
+}
+
+func TestRemoveDocumentRestoresCounts(t *testing.T) {
+	c := trainedClassifier(t)
+	before := trainedClassifier(t)
+	const message = "free money for the brand new team"
+	if err := c.AddDocument(message, Spam); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveDocument(message, Spam); err != nil {
+		t.Fatal(err)
+	}
+	sameCounts(t, c, before)
+	checkTotals(t, c)
+
+	// Removing what was never added clamps at zero.
+	if err := c.RemoveDocument("free free free free free", Ham); err != nil {
+		t.Fatal(err)
+	}
+	for label, bow := range c.Bows {
+		for word, n := range bow {
+			if n <= 0 {
+				t.Errorf("%s count of %s dropped to %d", label, word, n)
+			}
+		}
+	}
+}
+
+func TestWorkerErrorsDoNotLeak(t *testing.T) {
+	// Enough files that the workers are busy when one of them fails.
+	dir := t.TempDir()
+	var paths []string
+	for i := range 50 {
+		path := filepath.Join(dir, fmt.Sprintf("%02d.txt", i))
+		if err := os.WriteFile(path, []byte("free money for the team meeting"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	unreadable := paths[20]
+	if err := os.Remove(unreadable); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "gone"), unreadable); err != nil {
+		t.Fatal(err)
+	}
+
+	before := runtime.NumGoroutine()
+	for _, failFast := range []bool{false, true} {
+		c := NewClassifier()
+		c.Workers = 4
+		c.FailFast = failFast
+		if err := c.TrainFiles(paths, Spam); !errors.Is(err, fs.ErrNotExist) || !strings.Contains(err.Error(), unreadable) {
+			t.Errorf("TrainFiles with FailFast %v = %v, want the error of %s", failFast, err, unreadable)
+		}
+	}
+	c := trainedClassifier(t)
+	c.Workers = 4
+	if _, err := c.ClassifyDirResultsContext(context.Background(), dir); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ClassifyDirResultsContext = %v, want the error of %s", err, unreadable)
+	}
+
+	// Workers have all returned by the time the calls do, but give the
+	// runtime a moment to account for them.
+	for range 100 {
+		if runtime.NumGoroutine() <= before {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("%d goroutines before training and classifying, %d after", before, runtime.NumGoroutine())
+}
+
+func TestClassifyDirIsReproducible(t *testing.T) {
+	// WalkDir visits a/b.txt before a-c.txt, while path order is the other
+	// way round.
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, name := range []string{"a-c.txt", "a/b.txt", "b.txt", "c.txt", "d.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("free meeting "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, path)
+	}
+
+	c := trainedClassifier(t)
+	c.Workers = 4
+	run := func() []byte {
+		results, err := c.ClassifyDirResults(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, result := range results {
+			if result.Path != want[i] {
+				t.Errorf("result %d is for %s, want %s", i, result.Path, want[i])
+			}
+		}
+		output, err := json.Marshal(results)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return output
+	}
+	if first, second := run(), run(); !bytes.Equal(first, second) {
+		t.Errorf("two runs gave different results:\n%s\n%s", first, second)
+	}
+}
+
+func TestLikelihoodsSumToOne(t *testing.T) {
+	// With a cutoff of 2 only free, meeting and tomorrow count, so the
+	// totals have to leave the rest out as well.
+	c := NewClassifier()
+	c.MinWordFreq = 2
+	for _, doc := range trainingDocs {
+		if err := c.AddDocument(doc.text, doc.label); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.VocabSize != 3 {
+		t.Fatalf("vocabulary has %d words, want 3", c.VocabSize)
+	}
+	for _, label := range c.Labels() {
+		sum := 0.0
+		c.eachVocabularyWord(func(word string) {
+			sum += math.Exp(c.logLikelihood(word, label))
+		})
+		if math.Abs(sum-1) > 1e-12 {
+			t.Errorf("%s likelihoods sum to %v, want 1", label, sum)
+		}
+	}
+}
+
+func TestWeightedCorrection(t *testing.T) {
+	// Ten copies of the corpus make a model that one correction does not
+	// turn around.
+	base := func() *Classifier {
+		c := NewClassifier()
+		c.MinWordFreq = 1
+		for range 10 {
+			for _, doc := range trainingDocs {
+				if err := c.AddDocument(doc.text, doc.label); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		return c
+	}
+	const message = "free money tomorrow"
+	corrected := func(weight int, times int) (string, float64) {
+		t.Helper()
+		c := base()
+		for range times {
+			if err := c.AddWeightedDocument(message, Ham, weight); err != nil {
+				t.Fatal(err)
+			}
+		}
+		label, p, err := c.ClassifyText(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return label, p
+	}
+
+	if label, p := corrected(1, 1); label != Spam {
+		t.Fatalf("one unweighted correction already made %s ham at %v", message, p)
+	}
+	label, p := corrected(5, 1)
+	if label != Ham {
+		t.Errorf("a correction of weight 5 left %s %s at %v, want ham", message, label, p)
+	}
+	if _, want := corrected(1, 5); math.Abs(p-want) > 1e-12 {
+		t.Errorf("a correction of weight 5 gives P(spam) %v, want %v as for five corrections", p, want)
+	}
+
+	c := base()
+	if err := c.AddWeightedDocument(message, Ham, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveWeightedDocument(message, Ham, 5); err != nil {
+		t.Fatal(err)
+	}
+	sameCounts(t, c, base())
+
+	if err := c.AddWeightedDocument(message, Ham, 0); err == nil {
+		t.Error("AddWeightedDocument accepted a weight of 0")
+	}
+}
+
+func TestCalibrationMovesProbabilities(t *testing.T) {
+	c := trainedClassifier(t)
+	heldOut := writeCorpus(t,
+		[]string{"notes for the team", "meeting with the project team", "status of the lunch"},
+		[]string{"free pills now", "click here for cheap money", "free shipping offer"})
+	files, err := labeledFiles(heldOut, DefaultCorpusLayout, ExtFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := []string{"free money now", "free meeting", "project status tomorrow", "cheap pills free shipping offer"}
+	raw := make([]float64, len(messages))
+	for i, message := range messages {
+		if _, raw[i], err = c.ClassifyText(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Calibrate(files); err != nil {
+		t.Fatal(err)
+	}
+	moved := false
+	for i, message := range messages {
+		_, p, err := c.ClassifyText(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p < 0 || p > 1 || math.IsNaN(p) {
+			t.Errorf("calibrated P(spam) of %q is %v", message, p)
+		}
+		if math.Abs(p-raw[i]) > 1e-6 {
+			moved = true
+		}
+	}
+	if !moved {
+		t.Error("calibration left every probability where it was")
+	}
+}
+
+func TestTFIDFDownweightsCommonTerms(t *testing.T) {
+	// "regards" ends every message, "pills" occurs in only one.
+	c := NewClassifier()
+	c.MinWordFreq = 1
+	for _, doc := range trainingDocs {
+		if err := c.AddDocument(doc.text+" regards", doc.label); err != nil {
+			t.Fatal(err)
+		}
+	}
+	contribution := func(word string, label string) float64 {
+		return c.labelScores(Bow{word: 1})[label] - c.labelScores(Bow{})[label]
+	}
+
+	c.TFIDF = true
+	if common, rare := c.termWeight("regards", 1), c.termWeight("pills", 1); common >= rare {
+		t.Errorf("TF-IDF weighs regards %v and pills %v, want regards lower", common, rare)
+	}
+	tfidf := map[string]map[string]float64{}
+	for _, word := range []string{"regards", "pills"} {
+		tfidf[word] = map[string]float64{}
+		for _, label := range c.Labels() {
+			tfidf[word][label] = contribution(word, label)
+		}
+	}
+	c.TFIDF = false
+	for _, label := range c.Labels() {
+		common := tfidf["regards"][label] / contribution("regards", label)
+		rare := tfidf["pills"][label] / contribution("pills", label)
+		if common >= rare {
+			t.Errorf("TF-IDF scales the %s score of regards by %v and of pills by %v, want regards scaled down more", label, common, rare)
+		}
+	}
+}
+
+func TestPruneShrinksModel(t *testing.T) {
+	c := NewClassifier()
+	c.MinWordFreq = 2
+	for _, doc := range trainingDocs {
+		if err := c.AddDocument(doc.text, doc.label); err != nil {
+			t.Fatal(err)
+		}
+	}
+	words := func() int {
+		distinct := make(map[string]bool)
+		for _, bow := range c.Bows {
+			for word := range bow {
+				distinct[word] = true
+			}
+		}
+		return len(distinct)
+	}
+	size := func() int {
+		var saved bytes.Buffer
+		if err := c.SaveGob(&saved); err != nil {
+			t.Fatal(err)
+		}
+		return saved.Len()
+	}
+	type scores struct{ spam, ham float64 }
+	classify := func() []scores {
+		var all []scores
+		for _, doc := range trainingDocs {
+			spamScore, hamScore, err := c.ClassifyReader(strings.NewReader(doc.text))
+			if err != nil {
+				t.Fatal(err)
+			}
+			all = append(all, scores{spamScore, hamScore})
+		}
+		return all
+	}
+
+	wordsBefore, sizeBefore, scoresBefore := words(), size(), classify()
+	if pruned := c.Prune(); pruned == 0 {
+		t.Fatal("Prune dropped no words")
+	}
+	if after := words(); after >= wordsBefore {
+		t.Errorf("the Bows hold %d words after Prune, %d before", after, wordsBefore)
+	}
+	if after := size(); after >= sizeBefore {
+		t.Errorf("the saved model is %d bytes after Prune, %d before", after, sizeBefore)
+	}
+	if scoresAfter := classify(); !slices.Equal(scoresAfter, scoresBefore) {
+		t.Errorf("training messages score %v after Prune, %v before", scoresAfter, scoresBefore)
+	}
+}
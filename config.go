@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// parseFlags parses args into fs after adding a --config flag to it. A
+// config file sets flags by name, with the command line taking precedence:
+//
+//	# spam.yaml
+//	min-word-freq: 20
+//	casing: preserve
+//	threshold: 0.9
+//	train-dir:
+//	  - data/enron1
+//	  - data/enron2
+//
+// so `train --config spam.yaml --min-word-freq 50` uses 50. A repeatable
+// flag given on the command line replaces the file's list rather than
+// adding to it. Keys that name no flag of the subcommand are ignored, so one
+// file can serve train, classify and evaluate alike.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	configPath := fs.String("config", "", "read flag values from this YAML file; flags on the command line override it")
+	fs.Parse(args)
+	if *configPath == "" {
+		return nil
+	}
+
+	values, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, value := range values {
+		if set[value.name] || fs.Lookup(value.name) == nil {
+			continue
+		}
+		for _, item := range value.items {
+			if err := fs.Set(value.name, item); err != nil {
+				return fmt.Errorf("%s:%d: invalid value %q for %s: %w", *configPath, value.line, item, value.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configValue is one key of a config file with its scalar value, or the
+// items of its list.
+type configValue struct {
+	name  string
+	items []string
+	line  int
+}
+
+// loadConfig reads the subset of YAML a flat list of flags needs: comments,
+// "key: value" pairs with plain or quoted scalars, and lists written either
+// as [a, b] or as indented "- item" lines.
+func loadConfig(path string) ([]configValue, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var values []configValue
+	list := -1 // index of the value whose "- item" lines may follow
+	seen := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := stripConfigComment(scanner.Text())
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+
+		if item, ok := strings.CutPrefix(trimmed, "- "); ok || trimmed == "-" {
+			if list < 0 {
+				return nil, fmt.Errorf("%s:%d: list item outside of a list", path, line)
+			}
+			value, err := configScalar(strings.TrimSpace(item))
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			values[list].items = append(values[list].items, value)
+			continue
+		}
+
+		if text != strings.TrimLeft(text, " \t") {
+			return nil, fmt.Errorf("%s:%d: nested mappings are not supported", path, line)
+		}
+		name, raw, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: want \"key: value\", got %q", path, line, trimmed)
+		}
+		name = strings.TrimSpace(name)
+		if first, ok := seen[name]; ok {
+			return nil, fmt.Errorf("%s:%d: %s is already set on line %d", path, line, name, first)
+		}
+		seen[name] = line
+
+		value := configValue{name: name, line: line}
+		raw = strings.TrimSpace(raw)
+		list = -1
+		switch {
+		case raw == "":
+			// The items follow as "- item" lines.
+			list = len(values)
+		case strings.HasPrefix(raw, "["):
+			if !strings.HasSuffix(raw, "]") {
+				return nil, fmt.Errorf("%s:%d: unterminated list %q", path, line, raw)
+			}
+			for _, item := range strings.Split(raw[1:len(raw)-1], ",") {
+				if item = strings.TrimSpace(item); item == "" {
+					continue
+				}
+				item, err := configScalar(item)
+				if err != nil {
+					return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+				}
+				value.items = append(value.items, item)
+			}
+		default:
+			item, err := configScalar(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			value.items = []string{item}
+		}
+		values = append(values, value)
+	}
+	return values, scanner.Err()
+}
+
+// configScalar unquotes a single- or double-quoted value; plain values are
+// returned as they are.
+func configScalar(s string) (string, error) {
+	if len(s) == 0 || (s[0] != '"' && s[0] != '\'') {
+		return s, nil
+	}
+	if len(s) < 2 || s[len(s)-1] != s[0] {
+		return "", fmt.Errorf("unterminated quoted value %s", s)
+	}
+	if s[0] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	value, err := strconv.Unquote(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid quoted value %s", s)
+	}
+	return value, nil
+}
+
+// stripConfigComment cuts a " #" comment, or a line that is one, off line,
+// leaving any # inside quotes alone.
+func stripConfigComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testConfig = `# spam.yaml
+min-word-freq: 20
+casing: "preserve"
+threshold: 0.9 # stricter than the default
+train-dir:
+  - data/enron1
+  - data/enron2
+not-a-flag: ignored
+`
+
+// configFlags is a flag set with some of the flags of train.
+func configFlags() (*flag.FlagSet, *int, *string, *float64, *stringList) {
+	fs := flag.NewFlagSet("train", flag.ContinueOnError)
+	minWordFreq := fs.Int("min-word-freq", 5, "")
+	casing := fs.String("casing", "lower", "")
+	threshold := fs.Float64("threshold", 0.5, "")
+	var dirs stringList
+	fs.Var(&dirs, "train-dir", "")
+	return fs, minWordFreq, casing, threshold, &dirs
+}
+
+func TestCommandLineOverridesConfig(t *testing.T) {
+	path := writeFile(t, "spam.yaml", testConfig)
+	fs, minWordFreq, casing, threshold, dirs := configFlags()
+	if err := parseFlags(fs, []string{"--config", path, "--min-word-freq", "50", "--train-dir", "data/enron3"}); err != nil {
+		t.Fatal(err)
+	}
+	if *minWordFreq != 50 {
+		t.Errorf("min-word-freq is %d, want 50 from the command line", *minWordFreq)
+	}
+	if !slices.Equal(*dirs, stringList{"data/enron3"}) {
+		t.Errorf("train-dir is %q, want the command line's list alone", *dirs)
+	}
+	if *casing != "preserve" || *threshold != 0.9 {
+		t.Errorf("casing %q and threshold %v, want preserve and 0.9 from the file", *casing, *threshold)
+	}
+}
+
+func TestConfigWithoutFlags(t *testing.T) {
+	path := writeFile(t, "spam.yaml", testConfig)
+	fs, minWordFreq, _, _, dirs := configFlags()
+	if err := parseFlags(fs, []string{"--config", path}); err != nil {
+		t.Fatal(err)
+	}
+	if *minWordFreq != 20 || !slices.Equal(*dirs, stringList{"data/enron1", "data/enron2"}) {
+		t.Errorf("min-word-freq %d and train-dir %q, want 20 and the file's list", *minWordFreq, *dirs)
+	}
+}
+
+func TestConfigInvalidValue(t *testing.T) {
+	path := writeFile(t, "spam.yaml", "threshold: 0.9\nmin-word-freq: many\n")
+	fs, _, _, _, _ := configFlags()
+	err := parseFlags(fs, []string{"--config", path})
+	if err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("parseFlags = %v, want an error pointing at line 2", err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+)
+
+// CorpusLayout names the subdirectories of a corpus directory that hold the
+// messages of each class, e.g. legit/ and junk/ rather than ham/ and spam/.
+type CorpusLayout struct {
+	HamSubdir  string
+	SpamSubdir string
+}
+
+// DefaultCorpusLayout is the layout of the Enron corpus.
+var DefaultCorpusLayout = CorpusLayout{HamSubdir: "ham", SpamSubdir: "spam"}
+
+type corpusSubdir struct {
+	path  string
+	label string
+}
+
+func (l CorpusLayout) subdirs(dir string) []corpusSubdir {
+	return []corpusSubdir{
+		{filepath.Join(dir, l.HamSubdir), Ham},
+		{filepath.Join(dir, l.SpamSubdir), Spam},
+	}
+}
+
+// labelSubdirs is the layout of a corpus with classes other than ham and
+// spam: one subdirectory named after each label.
+func labelSubdirs(dir string, labels []string) []corpusSubdir {
+	subdirs := make([]corpusSubdir, len(labels))
+	for i, label := range labels {
+		subdirs[i] = corpusSubdir{filepath.Join(dir, label), label}
+	}
+	return subdirs
+}
+
+// TrainCorpus trains on both class subdirectories of dir, or with classes
+// other than ham and spam on the subdirectory named after each class. Like
+// Train it goes on past unreadable files, returning the FileErrors of all of
+// them at the end.
+func (c *Classifier) TrainCorpus(dir string, layout CorpusLayout) error {
+	c.mu.RLock()
+	subdirs := layout.subdirs(dir)
+	if !c.binary() {
+		subdirs = labelSubdirs(dir, c.labels())
+	}
+	c.mu.RUnlock()
+
+	var errs FileErrors
+	for _, sub := range subdirs {
+		err := c.Train(sub.path, sub.label)
+		var fileErrs FileErrors
+		if errors.As(err, &fileErrs) {
+			errs = append(errs, fileErrs...)
+		} else if err != nil {
+			return err
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// EvaluateCorpus evaluates c against both class subdirectories of dir.
+func (c *Classifier) EvaluateCorpus(dir string, layout CorpusLayout) (Evaluation, error) {
+	e, _, err := c.EvaluateCorpusFiles(dir, layout)
+	return e, err
+}
+
+// EvaluateCorpusFiles is EvaluateCorpus, also returning the result of every file.
+func (c *Classifier) EvaluateCorpusFiles(dir string, layout CorpusLayout) (Evaluation, []EvaluatedFile, error) {
+	return c.EvaluateFiles(filepath.Join(dir, layout.HamSubdir), filepath.Join(dir, layout.SpamSubdir))
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// LabeledFile is a message on disk together with its known label.
+type LabeledFile struct {
+	Path  string
+	Label string
+}
+
+// labeledFiles lists the files of a corpus directory laid out as layout
+// says that filter matches.
+func labeledFiles(dir string, layout CorpusLayout, filter ExtFilter) ([]LabeledFile, error) {
+	var files []LabeledFile
+	for _, sub := range layout.subdirs(dir) {
+		subdir := sub.path
+		if err := checkDir("corpus dir", subdir); err != nil {
+			return nil, err
+		}
+		paths, err := listFiles(context.Background(), subdir, filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			files = append(files, LabeledFile{Path: path, Label: sub.label})
+		}
+	}
+	return files, nil
+}
+
+// emptyCopy returns an untrained Classifier with the same settings as c.
+func (c *Classifier) emptyCopy() *Classifier {
+	empty := NewMultiClassifier(c.labels()...)
+	empty.Alpha = c.Alpha
+	empty.MinWordFreq = c.MinWordFreq
+	empty.Tokenizer = c.Tokenizer
+	empty.Tokenize = c.Tokenize
+	empty.Features = c.Features
+	empty.HashBuckets = c.HashBuckets
+	empty.ParseEmail = c.ParseEmail
+	empty.SubjectWeight = c.SubjectWeight
+	empty.StripHTML = c.StripHTML
+	empty.StripQuotes = c.StripQuotes
+	empty.Dedup = c.Dedup
+	empty.Workers = c.Workers
+	empty.Threshold = c.Threshold
+	empty.UnsureMargin = c.UnsureMargin
+	empty.BinaryRatio = c.BinaryRatio
+	empty.MaxFileSize = c.MaxFileSize
+	empty.FailFast = c.FailFast
+	empty.Extensions = c.Extensions
+	empty.TFIDF = c.TFIDF
+	empty.EventModel = c.EventModel
+	empty.Prior = c.Prior
+	empty.SpamWeight = c.SpamWeight
+	empty.HamWeight = c.HamWeight
+	empty.Logger = c.Logger
+	return empty
+}
+
+// TrainLabeled adds each file to the Bow of its label. Like Train, it skips
+// files it cannot read, unless FailFast is set, and returns them as
+// FileErrors once the rest are trained.
+func (c *Classifier) TrainLabeled(files []LabeledFile) error {
+	byLabel := make(map[string][]string)
+	for _, file := range files {
+		byLabel[file.Label] = append(byLabel[file.Label], file.Path)
+	}
+	labels := make([]string, 0, len(byLabel))
+	for label := range byLabel {
+		labels = append(labels, label)
+	}
+	// In a fixed order, so Dedup keeps the same copy of a duplicate and the
+	// errors come out the same on every run.
+	sort.Strings(labels)
+	var errs FileErrors
+	for _, label := range labels {
+		err := c.TrainFiles(byLabel[label], label)
+		var fileErrs FileErrors
+		if errors.As(err, &fileErrs) {
+			errs = append(errs, fileErrs...)
+		} else if err != nil {
+			return err
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// EvaluateLabeled classifies each file and compares the result to its label.
+// Files it cannot read are logged and left out, unless FailFast is set; any
+// other error, such as a model without words of some class, is returned.
+func (c *Classifier) EvaluateLabeled(files []LabeledFile) (Evaluation, error) {
+	labels := make([]string, len(files))
+	err := parallelFor(context.Background(), len(files), c.workers(), func(_ int, i int) error {
+		spamScore, hamScore, err := c.ClassifyFile(files[i].Path)
+		var pathErr *fs.PathError
+		if err != nil && !c.FailFast && errors.As(err, &pathErr) {
+			c.logger().Warn("unreadable file", "path", files[i].Path, "err", err)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		labels[i] = c.label(spamScore, hamScore)
+		return nil
+	})
+	if err != nil {
+		return Evaluation{}, err
+	}
+
+	var e Evaluation
+	for i, file := range files {
+		if labels[i] != "" {
+			e.add(file.Label == Spam, labels[i])
+		}
+	}
+	return e, nil
+}
+
+func (e *Evaluation) add(actualSpam bool, predicted string) {
+	switch {
+	case predicted == Unsure:
+		e.Unsure++
+	case actualSpam && predicted == Spam:
+		e.TruePositives++
+	case actualSpam:
+		e.FalseNegatives++
+	case predicted == Spam:
+		e.FalsePositives++
+	default:
+		e.TrueNegatives++
+	}
+}
+
+// SplitLabeled shuffles files with the given seed and holds out testRatio of
+// each label for testing, so both sets keep the corpus's mix of ham and
+// spam. The same files and seed always produce the same split.
+func SplitLabeled(files []LabeledFile, testRatio float64, seed int64) (train []LabeledFile, test []LabeledFile, err error) {
+	if testRatio <= 0 || testRatio >= 1 {
+		return nil, nil, fmt.Errorf("test ratio must be between 0 and 1, got %v", testRatio)
+	}
+
+	shuffled := append([]LabeledFile(nil), files...)
+	rand.New(rand.NewSource(seed)).Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	byLabel := make(map[string]int)
+	for _, file := range shuffled {
+		byLabel[file.Label]++
+	}
+	held := make(map[string]int)
+	for _, file := range shuffled {
+		if float64(held[file.Label]) < testRatio*float64(byLabel[file.Label]) {
+			held[file.Label]++
+			test = append(test, file)
+		} else {
+			train = append(train, file)
+		}
+	}
+	return train, test, nil
+}
+
+// CrossValidation holds the evaluation of every held-out fold.
+type CrossValidation struct {
+	Folds []Evaluation
+}
+
+// CrossValidate shuffles files with the given seed, splits them into k folds
+// and, for each fold, trains a fresh Classifier with c's settings on the
+// other k-1 folds and evaluates it on the held-out one. The same seed always
+// produces the same folds.
+func (c *Classifier) CrossValidate(files []LabeledFile, k int, seed int64) (CrossValidation, error) {
+	if k < 2 || k > len(files) {
+		return CrossValidation{}, fmt.Errorf("cannot split %d files into %d folds", len(files), k)
+	}
+
+	shuffled := append([]LabeledFile(nil), files...)
+	rand.New(rand.NewSource(seed)).Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	var cv CrossValidation
+	for fold := 0; fold < k; fold++ {
+		var train, test []LabeledFile
+		for i, file := range shuffled {
+			if i%k == fold {
+				test = append(test, file)
+			} else {
+				train = append(train, file)
+			}
+		}
+
+		model := c.emptyCopy()
+		// Unreadable files have been logged; validate on the rest.
+		var fileErrs FileErrors
+		if err := model.TrainLabeled(train); err != nil && !errors.As(err, &fileErrs) {
+			return cv, err
+		}
+		e, err := model.EvaluateLabeled(test)
+		if err != nil {
+			return cv, err
+		}
+		cv.Folds = append(cv.Folds, e)
+	}
+	return cv, nil
+}
+
+func (cv CrossValidation) mean(metric func(Evaluation) float64) float64 {
+	if len(cv.Folds) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, e := range cv.Folds {
+		sum += metric(e)
+	}
+	return sum / float64(len(cv.Folds))
+}
+
+func (cv CrossValidation) MeanAccuracy() float64 {
+	return cv.mean(Evaluation.Accuracy)
+}
+
+func (cv CrossValidation) MeanPrecision() float64 {
+	return cv.mean(Evaluation.Precision)
+}
+
+func (cv CrossValidation) MeanRecall() float64 {
+	return cv.mean(Evaluation.Recall)
+}
+
+func (cv CrossValidation) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-6s %9s %9s %9s\n", "fold", "accuracy", "precision", "recall")
+	for i, e := range cv.Folds {
+		fmt.Fprintf(&b, "%-6d %9.4f %9.4f %9.4f\n", i+1, e.Accuracy(), e.Precision(), e.Recall())
+	}
+	fmt.Fprintf(&b, "%-6s %9.4f %9.4f %9.4f", "mean", cv.MeanAccuracy(), cv.MeanPrecision(), cv.MeanRecall())
+	return b.String()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeCorpus creates a corpus directory with a ham and a spam subdirectory
+// holding the given messages, one file each, and returns its path.
+func writeCorpus(t testing.TB, ham []string, spam []string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, class := range []struct {
+		label    string
+		messages []string
+	}{{Ham, ham}, {Spam, spam}} {
+		subdir := filepath.Join(dir, class.label)
+		if err := os.Mkdir(subdir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for i, message := range class.messages {
+			name := filepath.Join(subdir, class.label+string(rune('a'+i))+".txt")
+			if err := os.WriteFile(name, []byte(message), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return dir
+}
+
+// smallCorpus holds enough of trainingDocs per class for two folds.
+func smallCorpus(t testing.TB) string {
+	var ham, spam []string
+	for _, doc := range trainingDocs {
+		if doc.label == Ham {
+			ham = append(ham, doc.text)
+		} else {
+			spam = append(spam, doc.text)
+		}
+	}
+	return writeCorpus(t, ham, spam)
+}
+
+func TestCrossValidateLogs(t *testing.T) {
+	files, err := labeledFiles(smallCorpus(t), DefaultCorpusLayout, ExtFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	c := NewClassifier()
+	c.MinWordFreq = 1
+	c.Logger = slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	if _, err := c.CrossValidate(files, 2, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(logs.String(), "processed file"); got != len(files) {
+		t.Errorf("logged %d processed files over 2 folds, want %d:\n%s", got, len(files), logs.String())
+	}
+}
+
+func TestCrossValidateSkipsUnreadableFiles(t *testing.T) {
+	files, err := labeledFiles(smallCorpus(t), DefaultCorpusLayout, ExtFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = append(files, LabeledFile{Path: filepath.Join(t.TempDir(), "missing.txt"), Label: Spam})
+
+	c := NewClassifier()
+	c.MinWordFreq = 1
+	cv, err := c.CrossValidate(files, 2, 1)
+	if err != nil {
+		t.Fatalf("CrossValidate stopped at an unreadable file: %v", err)
+	}
+	if len(cv.Folds) != 2 {
+		t.Errorf("got %d folds, want 2", len(cv.Folds))
+	}
+
+	c.FailFast = true
+	if _, err := c.CrossValidate(files, 2, 1); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("CrossValidate with FailFast returned %v, want the missing file", err)
+	}
+}
+
+func TestTrainLabeledIsReproducibleWithDedup(t *testing.T) {
+	// The same message filed under both labels: Dedup keeps whichever comes
+	// first, which has to be the same one every time.
+	var files []LabeledFile
+	dir := t.TempDir()
+	for i, file := range []struct{ label, text string }{
+		{Spam, "the very same words"},
+		{Ham, "the very same words"},
+		{Spam, "the very same words"},
+		{Ham, "the very same words"},
+		{Spam, "buy cheap pills"},
+		{Ham, "lunch with the team"},
+	} {
+		path := filepath.Join(dir, file.label+string(rune('a'+i)))
+		if err := os.WriteFile(path, []byte(file.text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, LabeledFile{Path: path, Label: file.label})
+	}
+
+	var first map[string]int
+	for run := range 10 {
+		c := NewClassifier()
+		c.Dedup = true
+		if err := c.TrainLabeled(files); err != nil {
+			t.Fatal(err)
+		}
+		if run == 0 {
+			first = c.Docs
+		} else if c.Docs[Ham] != first[Ham] || c.Docs[Spam] != first[Spam] {
+			t.Fatalf("run %d trained %v, run 0 %v", run, c.Docs, first)
+		}
+	}
+	if first[Ham] != 2 || first[Spam] != 1 {
+		t.Errorf("trained %v, want the duplicate as ham, the first label in order", first)
+	}
+}
+
+func TestCrossValidateReportsUntrainedFold(t *testing.T) {
+	// With a single ham message, the fold that holds it out trains no ham.
+	dir := writeCorpus(t, []string{"meeting notes for tomorrow"},
+		[]string{"win free money now", "free offer click here", "cheap pills free shipping"})
+	files, err := labeledFiles(dir, DefaultCorpusLayout, ExtFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClassifier()
+	c.MinWordFreq = 1
+	if _, err := c.CrossValidate(files, 2, 1); err == nil || !strings.Contains(err.Error(), "no ham words") {
+		t.Errorf("CrossValidate = %v, want an error about the missing ham words", err)
+	}
+}
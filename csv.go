@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// CSVColumns says where TrainCSV finds the label and the message text of each
+// row. A column is either a zero-based index or a header name; naming a
+// column implies Header.
+type CSVColumns struct {
+	Label  string
+	Text   string
+	Header bool
+}
+
+// TrainCSV trains on a CSV file with one labeled message per row, as many
+// public datasets ship (label "ham" or "spam", matched case-insensitively).
+func (c *Classifier) TrainCSV(path string, columns CSVColumns) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r, err := decompress(f)
+	if err != nil {
+		return err
+	}
+
+	rows := 0
+	err = eachCSVRow(r, columns, func(line int, label string, text string) error {
+		bow, err := c.bowFor(label)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		added, err := c.addTrainingReader(strings.NewReader(text), bow, c.docFreq())
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if !added {
+			return nil
+		}
+		c.countDocs(label, 1)
+		rows++
+		return nil
+	})
+	if err != nil {
+		// Rows before the bad one stay trained, so the totals have to count
+		// them.
+		c.updateTotals()
+		return err
+	}
+
+	c.updateTotals()
+	c.logger().Info("trained", "csv", path, "rows", rows)
+	return nil
+}
+
+// EvaluateCSV classifies every row of a labeled CSV test set and tallies the
+// results. Each row's path is the file name and line number.
+func (c *Classifier) EvaluateCSV(path string, columns CSVColumns) (Evaluation, []EvaluatedFile, error) {
+	var e Evaluation
+	if err := c.checkEvaluable(); err != nil {
+		return e, nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return e, nil, err
+	}
+	defer f.Close()
+
+	r, err := decompress(f)
+	if err != nil {
+		return e, nil, err
+	}
+
+	var files []EvaluatedFile
+	err = eachCSVRow(r, columns, func(line int, label string, text string) error {
+		if label != Ham && label != Spam {
+			return fmt.Errorf("line %d: unknown label %q", line, label)
+		}
+		result, err := c.Classify(strings.NewReader(text))
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		e.add(label == Spam, result.Label)
+		files = append(files, EvaluatedFile{
+			FileResult: FileResult{Path: fmt.Sprintf("%s:%d", path, line), Result: result},
+			TrueLabel:  label,
+		})
+		return nil
+	})
+	if err != nil {
+		return e, nil, err
+	}
+	return e, files, nil
+}
+
+// eachCSVRow calls fn with the line number, lowercased label and text of
+// every row of a CSV stream.
+func eachCSVRow(r io.Reader, columns CSVColumns, fn func(line int, label string, text string) error) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	labelCol, labelIndexed := csvColumnIndex(columns.Label)
+	textCol, textIndexed := csvColumnIndex(columns.Text)
+	if columns.Header || !labelIndexed || !textIndexed {
+		header, err := reader.Read()
+		if err != nil {
+			return fmt.Errorf("reading header: %w", err)
+		}
+		if !labelIndexed {
+			if labelCol, err = csvHeaderIndex(header, columns.Label); err != nil {
+				return err
+			}
+		}
+		if !textIndexed {
+			if textCol, err = csvHeaderIndex(header, columns.Text); err != nil {
+				return err
+			}
+		}
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		line, _ := reader.FieldPos(0)
+		if labelCol >= len(record) || textCol >= len(record) {
+			return fmt.Errorf("line %d: has %d columns, need %d", line, len(record), max(labelCol, textCol)+1)
+		}
+		label := strings.ToLower(strings.TrimSpace(record[labelCol]))
+		if err := fn(line, label, record[textCol]); err != nil {
+			return err
+		}
+	}
+}
+
+// csvColumnIndex reports whether column is a plain index rather than a name.
+func csvColumnIndex(column string) (int, bool) {
+	i, err := strconv.Atoi(column)
+	if err != nil || i < 0 {
+		return 0, false
+	}
+	return i, true
+}
+
+func csvHeaderIndex(header []string, name string) (int, error) {
+	for i, field := range header {
+		if strings.TrimSpace(field) == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("no column named %q in header %q", name, header)
+}
@@ -0,0 +1,16 @@
+package main
+
+import "testing"
+
+func TestTrainCSVKeepsTotalsOnError(t *testing.T) {
+	path := writeFile(t, "train.csv", "spam,free money now\nham,lunch with the team\neggs,not a label\n")
+	c := NewClassifier()
+	c.MinWordFreq = 1
+	if err := c.TrainCSV(path, CSVColumns{Label: "0", Text: "1"}); err == nil {
+		t.Fatal("TrainCSV accepted the label eggs")
+	}
+	if c.Docs[Spam] != 1 || c.Docs[Ham] != 1 {
+		t.Errorf("trained %v before the bad row, want one message of each", c.Docs)
+	}
+	checkTotals(t, c)
+}
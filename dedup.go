@@ -0,0 +1,24 @@
+package main
+
+import "crypto/sha256"
+
+// DuplicateReason is the SkippedFile reason of training files left out by
+// Dedup.
+const DuplicateReason = "duplicate of an earlier message"
+
+// seenBefore records content as trained and reports whether an identical
+// message was trained before. It is safe to call from the training workers.
+func (c *Classifier) seenBefore(content []byte) bool {
+	sum := sha256.Sum256(content)
+	c.dedupMu.Lock()
+	defer c.dedupMu.Unlock()
+	if c.seen == nil {
+		c.seen = make(map[[sha256.Size]byte]struct{})
+	}
+	if _, ok := c.seen[sum]; ok {
+		c.Duplicates++
+		return true
+	}
+	c.seen[sum] = struct{}{}
+	return false
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDedupSkipsDuplicates(t *testing.T) {
+	spam := []string{"free money now", "free money now", "cheap pills", "free money now", "cheap pills"}
+	dir := writeCorpus(t, []string{"meeting notes"}, spam)
+
+	train := func(dedup bool) *Classifier {
+		c := NewClassifier()
+		c.MinWordFreq = 1
+		c.Dedup = dedup
+		if err := c.Train(filepath.Join(dir, Spam), Spam); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	c := train(true)
+	if c.Docs[Spam] != 2 || c.Duplicates != 3 {
+		t.Errorf("trained %d messages and skipped %d duplicates, want 2 and 3", c.Docs[Spam], c.Duplicates)
+	}
+	if n := c.Bows[Spam]["free"]; n != 1 {
+		t.Errorf("free counted %d times, want 1", n)
+	}
+	var skipped []string
+	for _, file := range c.Skipped {
+		if file.Reason == DuplicateReason {
+			skipped = append(skipped, filepath.Base(file.Path))
+		}
+	}
+	if len(skipped) != 3 {
+		t.Errorf("skipped %q as duplicates, want the 3 later copies", skipped)
+	}
+
+	// Without Dedup every copy counts.
+	if c := train(false); c.Docs[Spam] != 5 || c.Duplicates != 0 || c.Bows[Spam]["free"] != 3 {
+		t.Errorf("without Dedup trained %d messages, %d duplicates and free %d times; want 5, 0 and 3",
+			c.Docs[Spam], c.Duplicates, c.Bows[Spam]["free"])
+	}
+}
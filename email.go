@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+)
+
+// extractEmailText parses raw as an RFC 822 message and returns its subject
+// followed by the decoded text/plain parts. text/html parts are used only when
+// there is no plain text. Anything that doesn't parse, or has no text part at
+// all, falls back to the raw bytes.
+func extractEmailText(raw []byte) []byte {
+	subject, body := extractEmailParts(raw)
+	if subject == "" {
+		return body
+	}
+
+	var text bytes.Buffer
+	text.WriteString(subject)
+	text.WriteString("\n")
+	text.Write(body)
+	return text.Bytes()
+}
+
+// extractEmailParts is extractEmailText with the decoded subject kept apart
+// from the body text. A message that falls back to the raw bytes has no
+// subject.
+func extractEmailParts(raw []byte) (string, []byte) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return "", raw
+	}
+
+	var plain, html bytes.Buffer
+	collectTextParts(msg.Header, msg.Body, &plain, &html)
+
+	body := plain.Bytes()
+	if len(body) == 0 {
+		body = html.Bytes()
+	}
+	if len(body) == 0 {
+		return "", raw
+	}
+
+	subject := msg.Header.Get("Subject")
+	decoder := &mime.WordDecoder{CharsetReader: charsetReader}
+	if decoded, err := decoder.DecodeHeader(subject); err == nil {
+		subject = decoded
+	}
+	return subject, body
+}
+
+// textHeader is the part of a message or MIME part header collectTextParts
+// needs; both mail.Header and textproto.MIMEHeader have it.
+type textHeader interface {
+	Get(key string) string
+}
+
+// collectTextParts walks a (possibly nested multipart) body and appends every
+// text/plain part to plain and every text/html part to html, undoing their
+// Content-Transfer-Encoding and converting them to UTF-8 from the charset
+// they declare (UTF-8 when they declare none). Parts in a charset toUTF8
+// does not know are kept as they are.
+func collectTextParts(header textHeader, body io.Reader, plain *bytes.Buffer, html *bytes.Buffer) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		// A missing or broken Content-Type defaults to text/plain per RFC 2045.
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				return
+			}
+			collectTextParts(part.Header, part, plain, html)
+		}
+	}
+
+	var text *bytes.Buffer
+	switch mediaType {
+	case "text/plain":
+		text = plain
+	case "text/html":
+		text = html
+	default:
+		return
+	}
+	raw, _ := io.ReadAll(body)
+	decoded, _ := toUTF8(params["charset"], decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), raw))
+	text.Write(decoded)
+	text.WriteString("\n")
+}
+
+// decodeTransferEncoding undoes a quoted-printable or base64 transfer
+// encoding. multipart already decodes quoted-printable parts itself and
+// drops their header, so this mostly matters for base64 parts and
+// single-part messages. Malformed input is returned as is: the encoded text
+// is still better to tokenize than nothing.
+func decodeTransferEncoding(encoding string, raw []byte) []byte {
+	var decoded []byte
+	var err error
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		decoded, err = io.ReadAll(quotedprintable.NewReader(bytes.NewReader(raw)))
+	case "base64":
+		// The decoder skips line breaks but not other whitespace.
+		decoded, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(raw)), ""))
+	default:
+		return raw
+	}
+	if err != nil {
+		return raw
+	}
+	return decoded
+}
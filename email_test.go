@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+const multipartMessage = "From: a@example.com\r\n" +
+	"Subject: =?utf-8?q?Caf=C3=A9_offer?=\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/alternative; boundary=b\r\n" +
+	"\r\n" +
+	"--b\r\n" +
+	"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Caf=E9 cr=E8me, act now!\r\n" +
+	"--b\r\n" +
+	"Content-Type: text/html\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"PGI+Q2Fmw6k8L2I+\r\n" +
+	"--b--\r\n"
+
+func TestParseEmailTransferEncodings(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{
+			"quoted-printable",
+			"Subject: offer\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n" +
+				"Free money, click =\r\nhere now =3D claim =E2=82=AC5\r\n",
+			"offer\nFree money, click here now = claim €5\r\n\n",
+		},
+		{
+			"base64",
+			"Content-Transfer-Encoding: base64\r\n\r\n" +
+				"RnJlZSBtb25leSwgY2xpY2sgaGVyZSBub3cgdG8g\r\nY2xhaW0geW91ciBwcml6ZQ==\r\n",
+			"Free money, click here now to claim your prize\n",
+		},
+		{
+			"base64 with spaces",
+			"Content-Transfer-Encoding: BASE64 \r\n\r\n RnJlZSBtb25leSwgY2xpY2sgaGVyZSBub3cgdG8g Y2xhaW0geW91ciBwcml6ZQ==\r\n",
+			"Free money, click here now to claim your prize\n",
+		},
+		{
+			"malformed base64",
+			"Content-Transfer-Encoding: base64\r\n\r\n!!!not base64\r\n",
+			"!!!not base64\r\n\n",
+		},
+		{
+			"multipart",
+			multipartMessage,
+			"Café offer\nCafé crème, act now!\n",
+		},
+		{
+			"seven bit",
+			"Subject: lunch\r\n\r\nSee you at noon.\r\n",
+			"lunch\nSee you at noon.\r\n\n",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := string(extractEmailText([]byte(test.raw))); got != test.want {
+				t.Errorf("extractEmailText = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestToUTF8(t *testing.T) {
+	for _, test := range []struct {
+		charset string
+		text    string
+		want    string
+		ok      bool
+	}{
+		{"iso-8859-1", "caf\xe9 cr\xe8me", "café crème", true},
+		{"Latin1", "\xa35 \xff", "£5 ÿ", true},
+		// ISO-8859-1 has C1 controls where windows-1252 has printable marks.
+		{"iso-8859-1", "\x80\x93", "\u0080\u0093", true},
+		{"windows-1252", "\x805 \x93free\x94 \x96 caf\xe9", "€5 “free” – café", true},
+		{"cp1252", "\x85\x99\x9f", "…™Ÿ", true},
+		{"windows-1252", "\x81\x8d\x8f\x90\x9d", "\ufffd\ufffd\ufffd\ufffd\ufffd", true},
+		{"UTF-8", "café €", "café €", true},
+		{"koi8-r", "\xc6", "\xc6", false},
+	} {
+		got, ok := toUTF8(test.charset, []byte(test.text))
+		if string(got) != test.want || ok != test.ok {
+			t.Errorf("toUTF8(%q, %q) = %q, %v; want %q, %v", test.charset, test.text, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestParseEmailCharsets(t *testing.T) {
+	raw := "Subject: =?windows-1252?q?=80100_prize?=\r\n" +
+		"Content-Type: text/plain; charset=windows-1252\r\n" +
+		"Content-Transfer-Encoding: 8bit\r\n" +
+		"\r\n" +
+		"Win \x80100 at the caf\xe9 \x96 \x93free\x94!\r\n"
+	want := "€100 prize\nWin €100 at the café – “free”!\r\n\n"
+	if got := string(extractEmailText([]byte(raw))); got != want {
+		t.Errorf("extractEmailText = %q, want %q", got, want)
+	}
+}
+
+func FuzzParseEmail(f *testing.F) {
+	addDataSeeds(f)
+	f.Add([]byte(multipartMessage))
+	f.Add([]byte("Subject: hi\r\n\r\n"))
+	f.Add([]byte("Content-Type: multipart/mixed; boundary=\"x\"\r\n\r\n--x\r\nContent-Type: multipart/mixed; boundary=\"x\"\r\n\r\n--x--"))
+	f.Add([]byte("Content-Transfer-Encoding: base64\r\n\r\n!!!not base64"))
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		subject, body := extractEmailParts(raw)
+		text := extractEmailText(raw)
+		if len(raw) > 0 && len(text) == 0 {
+			t.Fatalf("%q reduced to nothing", raw)
+		}
+		if subject == "" && !bytes.Equal(text, body) {
+			t.Fatalf("text %q is not the body %q", text, body)
+		}
+		if subject != "" && !bytes.Equal(text, []byte(subject+"\n"+string(body))) {
+			t.Fatalf("text %q is not subject %q and body %q", text, subject, body)
+		}
+	})
+}
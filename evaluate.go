@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Evaluation is the confusion matrix of a labeled test run, with spam as the
+// positive class.
+type Evaluation struct {
+	TruePositives  int // spam labeled spam
+	FalsePositives int // ham labeled spam
+	TrueNegatives  int // ham labeled ham
+	FalseNegatives int // spam labeled ham
+
+	// Unsure counts the messages of either class labeled Unsure. They are
+	// left out of the matrix and every rate below.
+	Unsure int
+}
+
+// Total is the number of messages labeled spam or ham.
+func (e Evaluation) Total() int {
+	return e.TruePositives + e.FalsePositives + e.TrueNegatives + e.FalseNegatives
+}
+
+// Accuracy is the fraction of messages labeled correctly, or 0 for an empty run.
+func (e Evaluation) Accuracy() float64 {
+	if e.Total() == 0 {
+		return 0
+	}
+	return float64(e.TruePositives+e.TrueNegatives) / float64(e.Total())
+}
+
+// Precision is the fraction of messages labeled spam that really are spam.
+// By convention it is 0 when nothing was labeled spam.
+func (e Evaluation) Precision() float64 {
+	predicted := e.TruePositives + e.FalsePositives
+	if predicted == 0 {
+		return 0
+	}
+	return float64(e.TruePositives) / float64(predicted)
+}
+
+// Recall is the fraction of spam that was caught. By convention it is 0 when
+// the test set holds no spam.
+func (e Evaluation) Recall() float64 {
+	actual := e.TruePositives + e.FalseNegatives
+	if actual == 0 {
+		return 0
+	}
+	return float64(e.TruePositives) / float64(actual)
+}
+
+// F1 is the harmonic mean of Precision and Recall, or 0 when both are 0.
+func (e Evaluation) F1() float64 {
+	precision := e.Precision()
+	recall := e.Recall()
+	if precision+recall == 0 {
+		return 0
+	}
+	return 2 * precision * recall / (precision + recall)
+}
+
+func (e Evaluation) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-12s %9s %9s\n", "", "pred spam", "pred ham")
+	fmt.Fprintf(&b, "%-12s %9d %9d\n", "actual spam", e.TruePositives, e.FalseNegatives)
+	fmt.Fprintf(&b, "%-12s %9d %9d\n", "actual ham", e.FalsePositives, e.TrueNegatives)
+	fmt.Fprintf(&b, "accuracy:  %.2f%% (%d/%d)\n", 100*e.Accuracy(), e.TruePositives+e.TrueNegatives, e.Total())
+	fmt.Fprintf(&b, "precision: %.4f\n", e.Precision())
+	fmt.Fprintf(&b, "recall:    %.4f\n", e.Recall())
+	fmt.Fprintf(&b, "f1:        %.4f", e.F1())
+	if e.Unsure > 0 {
+		fmt.Fprintf(&b, "\nunsure:    %d", e.Unsure)
+	}
+	return b.String()
+}
+
+// checkEvaluable fails evaluations of a Classifier whose classes are not ham
+// and spam, which an Evaluation cannot tally.
+func (c *Classifier) checkEvaluable() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.checkBinary()
+}
+
+// EvaluatedFile is the result of classifying a test file of known label.
+type EvaluatedFile struct {
+	FileResult
+	TrueLabel string
+}
+
+// Evaluate classifies the known-ham files under hamDir and the known-spam
+// files under spamDir and tallies the results.
+func (c *Classifier) Evaluate(hamDir string, spamDir string) (Evaluation, error) {
+	e, _, err := c.EvaluateFiles(hamDir, spamDir)
+	return e, err
+}
+
+// EvaluateFiles is Evaluate, also returning the result of every file.
+func (c *Classifier) EvaluateFiles(hamDir string, spamDir string) (Evaluation, []EvaluatedFile, error) {
+	var e Evaluation
+	if err := c.checkEvaluable(); err != nil {
+		return e, nil, err
+	}
+	var files []EvaluatedFile
+	for _, dir := range []struct{ path, label string }{{hamDir, Ham}, {spamDir, Spam}} {
+		results, err := c.ClassifyDirResults(dir.path)
+		if err != nil {
+			return e, nil, err
+		}
+		for _, result := range results {
+			e.add(dir.label == Spam, result.Label)
+			files = append(files, EvaluatedFile{FileResult: result, TrueLabel: dir.label})
+		}
+	}
+	return e, files, nil
+}
+
+// Disagreement is a test file that two models labeled differently.
+type Disagreement struct {
+	Path      string
+	TrueLabel string
+	A, B      Result
+}
+
+// Disagreements pairs up the results of two models on the same test files by
+// path and returns those they labeled differently, in the order of a.
+func Disagreements(a []EvaluatedFile, b []EvaluatedFile) []Disagreement {
+	byPath := make(map[string]Result, len(b))
+	for _, file := range b {
+		byPath[file.Path] = file.Result
+	}
+	var disagreements []Disagreement
+	for _, file := range a {
+		other, ok := byPath[file.Path]
+		if ok && other.Label != file.Label {
+			disagreements = append(disagreements, Disagreement{Path: file.Path, TrueLabel: file.TrueLabel, A: file.Result, B: other})
+		}
+	}
+	return disagreements
+}
+
+// Misclassified picks the false positives (ham labeled spam) and false
+// negatives (spam labeled ham) out of files, each ordered from the most
+// confidently wrong.
+func Misclassified(files []EvaluatedFile) (falsePositives []EvaluatedFile, falseNegatives []EvaluatedFile) {
+	for _, file := range files {
+		switch {
+		case file.TrueLabel == Ham && file.Label == Spam:
+			falsePositives = append(falsePositives, file)
+		case file.TrueLabel == Spam && file.Label == Ham:
+			falseNegatives = append(falseNegatives, file)
+		}
+	}
+	sort.SliceStable(falsePositives, func(i, j int) bool {
+		return falsePositives[i].Probability > falsePositives[j].Probability
+	})
+	sort.SliceStable(falseNegatives, func(i, j int) bool {
+		return falseNegatives[i].Probability < falseNegatives[j].Probability
+	})
+	return falsePositives, falseNegatives
+}
+
+// WriteEvaluationCSV writes a path,trueLabel,predLabel,pSpam row for every
+// file, followed by the confusion matrix as rows of an empty path, the true
+// and predicted label, and their count.
+func WriteEvaluationCSV(w io.Writer, e Evaluation, files []EvaluatedFile) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"path", "trueLabel", "predLabel", "pSpam"})
+	for _, file := range files {
+		out.Write([]string{file.Path, file.TrueLabel, file.Label, strconv.FormatFloat(file.Probability, 'g', -1, 64)})
+	}
+
+	out.Write([]string{"", "trueLabel", "predLabel", "count"})
+	for _, cell := range []struct {
+		trueLabel, predLabel string
+		count                int
+	}{
+		{Spam, Spam, e.TruePositives},
+		{Spam, Ham, e.FalseNegatives},
+		{Ham, Spam, e.FalsePositives},
+		{Ham, Ham, e.TrueNegatives},
+	} {
+		out.Write([]string{"", cell.trueLabel, cell.predLabel, strconv.Itoa(cell.count)})
+	}
+	if e.Unsure > 0 {
+		out.Write([]string{"", "", Unsure, strconv.Itoa(e.Unsure)})
+	}
+	out.Flush()
+	return out.Error()
+}
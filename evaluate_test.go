@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEvaluationMetrics(t *testing.T) {
+	for _, test := range []struct {
+		name                            string
+		e                               Evaluation
+		precision, recall, f1, accuracy float64
+	}{
+		{"balanced", Evaluation{TruePositives: 3, FalsePositives: 1, TrueNegatives: 4, FalseNegatives: 3}, 0.75, 0.5, 0.6, 7.0 / 11},
+		{"imbalanced", Evaluation{TruePositives: 8, FalsePositives: 2, TrueNegatives: 85, FalseNegatives: 5}, 0.8, 8.0 / 13, 16.0 / 23, 0.93},
+		{"perfect", Evaluation{TruePositives: 2, TrueNegatives: 2}, 1, 1, 1, 1},
+		{"nothing labeled spam", Evaluation{TrueNegatives: 5, FalseNegatives: 2}, 0, 0, 0, 5.0 / 7},
+		{"no spam", Evaluation{FalsePositives: 2, TrueNegatives: 3}, 0, 0, 0, 0.6},
+		{"empty", Evaluation{Unsure: 3}, 0, 0, 0, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			for _, metric := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"Precision", test.e.Precision(), test.precision},
+				{"Recall", test.e.Recall(), test.recall},
+				{"F1", test.e.F1(), test.f1},
+				{"Accuracy", test.e.Accuracy(), test.accuracy},
+			} {
+				if math.Abs(metric.got-metric.want) > 1e-12 {
+					t.Errorf("%s = %v, want %v", metric.name, metric.got, metric.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAccuracyVersusSize(t *testing.T) {
+	files, err := labeledFiles("data/enron1", DefaultCorpusLayout, ExtFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	train, test, err := SplitLabeled(files, 0.2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	evaluate := func(c *Classifier) float64 {
+		t.Helper()
+		e, err := c.EvaluateLabeled(test)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e.Accuracy()
+	}
+
+	// More training data never makes the model worse here.
+	previous := 0.0
+	var full *Classifier
+	for _, fraction := range []float64{0.1, 0.25, 0.5, 1} {
+		c := NewClassifier()
+		if err := c.TrainLabeled(train[:int(fraction*float64(len(train)))]); err != nil {
+			t.Fatal(err)
+		}
+		accuracy := evaluate(c)
+		if accuracy < previous {
+			t.Errorf("trained on %v of the files, accuracy dropped to %.4f from %.4f", fraction, accuracy, previous)
+		}
+		previous = accuracy
+		full = c
+	}
+
+	// Fewer features cost accuracy, but a few hundred keep most of it.
+	for _, k := range []int{200, 50} {
+		full.KeepTopFeatures(k)
+		accuracy := evaluate(full)
+		if accuracy > previous {
+			t.Errorf("keeping %d features, accuracy rose to %.4f from %.4f", k, accuracy, previous)
+		}
+		if accuracy < 0.85 {
+			t.Errorf("keeping %d features, accuracy fell to %.4f", k, accuracy)
+		}
+		previous = accuracy
+	}
+}
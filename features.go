@@ -0,0 +1,59 @@
+package main
+
+import "unicode"
+
+// FeatureExtractor turns a message into feature strings that are counted
+// like words, so hand-crafted signals such as "has an attachment" or "is
+// mostly capital letters" weigh in alongside the tokens:
+//
+//	type attachmentFeature struct{}
+//
+//	func (attachmentFeature) Extract(raw []byte) []string {
+//		if bytes.Contains(raw, []byte("Content-Disposition: attachment")) {
+//			return []string{"<ATTACHMENT>"}
+//		}
+//		return nil
+//	}
+//
+//	c := NewClassifier()
+//	c.Features = append(c.Features, attachmentFeature{})
+//
+// Extract gets the raw bytes of the message, after decompression but before
+// ParseEmail or StripHTML, so it can look at headers and markup. Returning a
+// feature several times counts it several times. The Classifier's own
+// tokenizer always runs as well, on the text ParseEmail and StripHTML leave
+// over, so extractors only need to add what it misses. Pick feature strings
+// that no tokenizer produces, e.g. <NAME> like EmailToken, so they do not add
+// to the counts of ordinary words.
+type FeatureExtractor interface {
+	Extract(raw []byte) []string
+}
+
+// CapsToken is the feature CapsRatioFeature emits.
+const CapsToken = "<CAPS>"
+
+// CapsRatioFeature emits CapsToken for messages in which more than Ratio of
+// the letters are upper case, as in "FREE OFFER, ACT NOW". Messages with
+// fewer than MinLetters letters emit nothing, since a short subject in
+// capitals says little.
+type CapsRatioFeature struct {
+	Ratio      float64
+	MinLetters int
+}
+
+func (f CapsRatioFeature) Extract(raw []byte) []string {
+	var letters, upper int
+	for _, r := range string(raw) {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+	if letters == 0 || letters < f.MinLetters || float64(upper) <= f.Ratio*float64(letters) {
+		return nil
+	}
+	return []string{CapsToken}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCapsRatioFeature(t *testing.T) {
+	feature := CapsRatioFeature{Ratio: 0.3, MinLetters: 5}
+	for _, test := range []struct {
+		message string
+		want    []string
+	}{
+		{"FREE OFFER, ACT NOW", []string{CapsToken}},
+		{"Free OFFER, act now", []string{CapsToken}},
+		{"Free offer, act now", nil},
+		{"HI", nil}, // too few letters to tell
+		{"123 !!! 456", nil},
+		{"", nil},
+		{"ÜBER GRÖSSE", []string{CapsToken}},
+	} {
+		if got := feature.Extract([]byte(test.message)); !slices.Equal(got, test.want) {
+			t.Errorf("Extract(%q) = %q, want %q", test.message, got, test.want)
+		}
+	}
+}
+
+func TestFeaturesAreCountedOnce(t *testing.T) {
+	c := NewClassifier()
+	c.Features = []FeatureExtractor{CapsRatioFeature{Ratio: 0.3, MinLetters: 5}}
+	if err := c.AddDocument("FREE OFFER ACT NOW", Spam); err != nil {
+		t.Fatal(err)
+	}
+	for word, want := range map[string]int{CapsToken: 1, "free": 1, "offer": 1} {
+		if got := c.Bows[Spam][word]; got != want {
+			t.Errorf("spam count of %q = %d, want %d", word, got, want)
+		}
+	}
+
+	if got := c.emptyCopy().Features; len(got) != 1 {
+		t.Errorf("emptyCopy has %d feature extractors, want 1", len(got))
+	}
+}
+
+func TestFeaturesSeeRawMessage(t *testing.T) {
+	var seen string
+	c := NewClassifier()
+	c.ParseEmail = true
+	c.Features = []FeatureExtractor{extractorFunc(func(raw []byte) []string {
+		seen = string(raw)
+		return nil
+	})}
+	message := "Subject: hi\r\nContent-Disposition: attachment\r\n\r\nbody"
+	if err := c.AddDocument(message, Ham); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(seen, "Content-Disposition") {
+		t.Errorf("extractor saw %q, want the headers too", seen)
+	}
+}
+
+type extractorFunc func(raw []byte) []string
+
+func (f extractorFunc) Extract(raw []byte) []string { return f(raw) }
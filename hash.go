@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultHashBuckets is a bucket count that keeps collisions rare for a
+// vocabulary of a few hundred thousand words.
+const DefaultHashBuckets = 1 << 18
+
+// buckets are the counts of one class, or the document frequencies, of a
+// model with HashBuckets set: a slice with one count per bucket instead of a
+// Bow. A word is counted in the bucket bucketIndex picks for it, so the
+// memory is fixed however many distinct words training sees, and counting a
+// token allocates nothing.
+type buckets []int
+
+// bucketIndex is the FNV-1a hash of word modulo n, computed by hand rather
+// than with hash/fnv so that hashing a token does not allocate.
+func bucketIndex(word string, n int) int {
+	const offset32, prime32 = 2166136261, 16777619
+	h := uint32(offset32)
+	for i := 0; i < len(word); i++ {
+		h ^= uint32(word[i])
+		h *= prime32
+	}
+	return int(h % uint32(n))
+}
+
+// bucketName is how inspection shows bucket i, e.g. "#1234", since a hashed
+// model no longer knows the words it counted.
+func bucketName(i int) string {
+	return "#" + strconv.Itoa(i)
+}
+
+func (b buckets) count(word string) int {
+	if len(b) == 0 {
+		return 0
+	}
+	return b[bucketIndex(word, len(b))]
+}
+
+func (b buckets) add(word string, n int) {
+	i := bucketIndex(word, len(b))
+	b[i] = max(b[i]+n, 0)
+}
+
+func (b buckets) size() int {
+	size := 0
+	for _, n := range b {
+		if n > 0 {
+			size++
+		}
+	}
+	return size
+}
+
+func (b buckets) merge(from countStore) {
+	for i, n := range from.(buckets) {
+		b[i] += n
+	}
+}
+
+// bucketsFor returns the buckets of label, allocating them and the
+// document frequency buckets on first use. It needs the write lock.
+func (c *Classifier) bucketsFor(label string) buckets {
+	if c.buckets == nil {
+		c.buckets = make(map[string]buckets)
+	}
+	if c.bucketDocFreq == nil {
+		c.bucketDocFreq = make(buckets, c.HashBuckets)
+	}
+	b := c.buckets[label]
+	if b == nil {
+		b = make(buckets, c.HashBuckets)
+		c.buckets[label] = b
+	}
+	return b
+}
+
+// foldBuckets merges the tokens of bow that hash to the same one of n
+// buckets into one of them, so that a message counts at most once towards
+// the document frequency of a bucket however many of its tokens collide
+// there.
+func foldBuckets(bow Bow, n int) {
+	first := make(map[int]string, len(bow))
+	for word, count := range bow {
+		i := bucketIndex(word, n)
+		if kept, ok := first[i]; ok {
+			bow[kept] += count
+			delete(bow, word)
+			continue
+		}
+		first[i] = word
+	}
+}
+
+// updateBucketTotals is updateTotals for a hashed model, with the buckets
+// that pass MinWordFreq as the vocabulary.
+func (c *Classifier) updateBucketTotals() {
+	labels := c.labels()
+	classes := make([]buckets, len(labels))
+	for j, label := range labels {
+		classes[j] = c.buckets[label]
+		c.Totals[label] = 0
+	}
+	c.VocabSize = 0
+	if c.EventModel == Bernoulli {
+		c.absent = make(map[string]float64)
+	}
+	for i := range c.HashBuckets {
+		if total := c.bucketCount(i); total == 0 || total < c.MinWordFreq {
+			continue
+		}
+		c.VocabSize++
+		for j, label := range labels {
+			n := 0
+			if classes[j] != nil {
+				n = classes[j][i]
+			}
+			c.Totals[label] += n
+			if c.EventModel == Bernoulli {
+				c.absent[label] += math.Log1p(-c.bernoulliLikelihood(n, c.Docs[label]))
+			}
+		}
+	}
+}
+
+// bucketCount is the count of bucket i across all classes.
+func (c *Classifier) bucketCount(i int) int {
+	count := 0
+	for _, b := range c.buckets {
+		count += b[i]
+	}
+	return count
+}
+
+// clearBuckets zeroes the buckets, in every class and in the document
+// frequencies, for which drop returns true and returns how many of those
+// held any counts.
+func (c *Classifier) clearBuckets(drop func(i int, count int) bool) int {
+	cleared := 0
+	for i := range c.HashBuckets {
+		count := c.bucketCount(i)
+		if count == 0 || !drop(i, count) {
+			continue
+		}
+		for _, b := range c.buckets {
+			b[i] = 0
+		}
+		if c.bucketDocFreq != nil {
+			c.bucketDocFreq[i] = 0
+		}
+		cleared++
+	}
+	return cleared
+}
+
+// wordView returns c itself, or for a hashed model a copy of the counts
+// that scoring and inspection need with every bucket that holds counts as
+// a Bow word named by bucketName, so that the methods listing words work on
+// either. The copy has no lock of its own; it is only read while c's lock
+// is held.
+func (c *Classifier) wordView() *Classifier {
+	if c.HashBuckets <= 0 {
+		return c
+	}
+	view := &Classifier{
+		Bows:        make(map[string]Bow),
+		Totals:      c.Totals,
+		VocabSize:   c.VocabSize,
+		Alpha:       c.Alpha,
+		Docs:        c.Docs,
+		EventModel:  c.EventModel,
+		MinWordFreq: c.MinWordFreq,
+		DocFreq:     bucketBow(c.bucketDocFreq),
+	}
+	for label := range c.Bows {
+		view.Bows[label] = bucketBow(c.buckets[label])
+	}
+	return view
+}
+
+// bucketBow names the buckets of b that hold counts as bucketName does.
+func bucketBow(b buckets) Bow {
+	bow := make(Bow)
+	for i, n := range b {
+		if n > 0 {
+			bow[bucketName(i)] = n
+		}
+	}
+	return bow
+}
+
+// bowBuckets converts bow, the counts of a model saved when hashed models
+// still kept bucketName words in their Bows, into n buckets.
+func bowBuckets(bow Bow, n int) (buckets, error) {
+	b := make(buckets, n)
+	for word, count := range bow {
+		i, err := strconv.Atoi(strings.TrimPrefix(word, "#"))
+		if err != nil || !strings.HasPrefix(word, "#") || i < 0 || i >= n {
+			return nil, fmt.Errorf("hashed model counts %q, which is not one of its %d buckets", word, n)
+		}
+		b[i] = count
+	}
+	return b, nil
+}
+
+// bucketCounts returns the buckets of the classes and the document
+// frequencies of m, a hashed model. Models saved before version 3 counted
+// them in the Bows under bucket names; those are converted, which leaves
+// bows, the classes of m, holding only the labels.
+func (m model) bucketCounts(bows map[string]Bow) (map[string]buckets, buckets, error) {
+	n := m.HashBuckets
+	counts := make(map[string]buckets, len(bows))
+	if m.Buckets == nil {
+		for label, bow := range bows {
+			b, err := bowBuckets(bow, n)
+			if err != nil {
+				return nil, nil, err
+			}
+			counts[label] = b
+			bows[label] = make(Bow)
+		}
+		docFreq, err := bowBuckets(m.DocFreq, n)
+		return counts, docFreq, err
+	}
+
+	for label, b := range m.Buckets {
+		switch len(b) {
+		case 0:
+			// A class that was never trained.
+		case n:
+			counts[label] = b
+		default:
+			return nil, nil, fmt.Errorf("model has %d %s buckets, not %d", len(b), label, n)
+		}
+	}
+	switch len(m.BucketDocFreq) {
+	case 0:
+		return counts, nil, nil
+	case n:
+		return counts, m.BucketDocFreq, nil
+	default:
+		return nil, nil, fmt.Errorf("model has %d document frequency buckets, not %d", len(m.BucketDocFreq), n)
+	}
+}
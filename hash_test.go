@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"hash/fnv"
+	"testing"
+)
+
+// hashedClassifier is trainedClassifier with HashBuckets set to n.
+func hashedClassifier(t *testing.T, n int, eventModel EventModel) *Classifier {
+	t.Helper()
+	c := NewClassifier()
+	c.MinWordFreq = 1
+	c.HashBuckets = n
+	c.EventModel = eventModel
+	for _, doc := range trainingDocs {
+		if err := c.AddDocument(doc.text, doc.label); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+func TestBucketIndexIsFNV(t *testing.T) {
+	for _, word := range []string{"", "free", "meeting", "naïve"} {
+		h := fnv.New32a()
+		h.Write([]byte(word))
+		if got, want := bucketIndex(word, DefaultHashBuckets), int(h.Sum32()%DefaultHashBuckets); got != want {
+			t.Errorf("bucketIndex(%q) = %d, want %d", word, got, want)
+		}
+	}
+	b := make(buckets, DefaultHashBuckets)
+	if allocs := testing.AllocsPerRun(100, func() { b.add("free", 1) }); allocs != 0 {
+		t.Errorf("counting a token allocates %v times", allocs)
+	}
+}
+
+func TestHashedCountsInBuckets(t *testing.T) {
+	plain := trainedClassifier(t)
+	c := hashedClassifier(t, DefaultHashBuckets, Multinomial)
+	for _, label := range c.Labels() {
+		if len(c.Bows[label]) != 0 {
+			t.Errorf("%s Bow holds %d words, want none", label, len(c.Bows[label]))
+		}
+		if got := len(c.buckets[label]); got != DefaultHashBuckets {
+			t.Errorf("%s has %d buckets, want %d", label, got, DefaultHashBuckets)
+		}
+		for word, count := range plain.Bows[label] {
+			if got := c.counts(label).count(word); got != count {
+				t.Errorf("%s count of %q is %d, want %d", label, word, got, count)
+			}
+		}
+	}
+	if c.Totals[Spam] != plain.Totals[Spam] || c.VocabSize != plain.VocabSize {
+		t.Errorf("totals are %v with vocabulary %d, want %v with %d", c.Totals, c.VocabSize, plain.Totals, plain.VocabSize)
+	}
+	// Without collisions hashing changes nothing.
+	spamA, hamA, _ := plain.ClassifyReader(bytes.NewBufferString("free money"))
+	spamB, hamB, _ := c.ClassifyReader(bytes.NewBufferString("free money"))
+	if spamA != spamB || hamA != hamB {
+		t.Errorf("hashed scores are %v, %v, want %v, %v", spamB, hamB, spamA, hamA)
+	}
+
+	spammy, _ := c.TopWords(1)
+	if want := bucketName(bucketIndex("free", DefaultHashBuckets)); len(spammy) != 1 || spammy[0].Word != want {
+		t.Errorf("top spam word is %v, want bucket %s of free", spammy, want)
+	}
+	stats, err := c.WordStats("FREE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.SpamCount != 3 || stats.Token != spammy[0].Word {
+		t.Errorf("WordStats(FREE) = %+v, want 3 spam counts in %s", stats, spammy[0].Word)
+	}
+}
+
+// TestHashedCollisions squeezes every word into one bucket: a message counts
+// towards its document frequency once, however many of its words share it.
+func TestHashedCollisions(t *testing.T) {
+	c := hashedClassifier(t, 1, Bernoulli)
+	if got := c.bucketDocFreq[0]; got != len(trainingDocs) {
+		t.Errorf("document frequency is %d, want %d", got, len(trainingDocs))
+	}
+	if got, want := c.buckets[Spam][0], c.Docs[Spam]; got != want {
+		t.Errorf("Bernoulli spam count is %d, want one per message, %d", got, want)
+	}
+	if _, _, err := c.ClassifyReader(bytes.NewBufferString("free lunch")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHashedRemoveAndPrune(t *testing.T) {
+	c := hashedClassifier(t, 64, Multinomial)
+	before := c.buckets[Spam].size()
+	if err := c.RemoveDocument(trainingDocs[0].text, trainingDocs[0].label); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddDocument(trainingDocs[0].text, trainingDocs[0].label); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.buckets[Spam].size(); got != before {
+		t.Errorf("removing and adding a message again left %d spam buckets, want %d", got, before)
+	}
+
+	c.MinWordFreq = 2
+	pruned := c.Prune()
+	if pruned == 0 {
+		t.Fatal("Prune dropped no buckets")
+	}
+	for i := range c.HashBuckets {
+		if count := c.bucketCount(i); count > 0 && count < c.MinWordFreq {
+			t.Errorf("bucket %d still counts %d after Prune", i, count)
+		}
+	}
+	if kept := c.VocabSize; c.KeepTopFeatures(1) != kept-1 || c.VocabSize != 1 {
+		t.Errorf("KeepTopFeatures(1) left a vocabulary of %d", c.VocabSize)
+	}
+}
+
+func TestHashedModelRoundTrip(t *testing.T) {
+	c := hashedClassifier(t, 64, Multinomial)
+	var saved bytes.Buffer
+	if err := c.SaveGob(&saved); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewClassifier()
+	if err := loaded.LoadGob(&saved); err != nil {
+		t.Fatal(err)
+	}
+	for _, message := range []string{"free money", "meeting tomorrow"} {
+		sameScores(t, c, loaded, message)
+	}
+	if err := loaded.AddDocument("free pills", Spam); err != nil {
+		t.Fatal(err)
+	}
+
+	merged := hashedClassifier(t, 64, Multinomial)
+	if err := merged.Merge(c); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := merged.Totals[Spam], 2*c.Totals[Spam]; got != want {
+		t.Errorf("merged spam total is %d, want %d", got, want)
+	}
+}
+
+// TestLoadHashedBowModel loads a model from before version 3, which kept
+// hashed counts in the Bows under bucket names.
+func TestLoadHashedBowModel(t *testing.T) {
+	m := model{
+		Version:     binaryModelVersion,
+		HamBow:      Bow{"#3": 2},
+		SpamBow:     Bow{"#5": 1},
+		DocFreq:     Bow{"#3": 1, "#5": 1},
+		Alpha:       1,
+		MinWordFreq: 1,
+		HashBuckets: 8,
+	}
+	c := NewClassifier()
+	if err := c.fromModel(m); err != nil {
+		t.Fatal(err)
+	}
+	if c.buckets[Ham][3] != 2 || c.buckets[Spam][5] != 1 || c.bucketDocFreq[3] != 1 {
+		t.Errorf("buckets are %v with document frequencies %v", c.buckets, c.bucketDocFreq)
+	}
+	if len(c.Bows[Ham]) != 0 || c.Totals[Ham] != 2 {
+		t.Errorf("ham Bow is %v with total %d, want empty with 2", c.Bows[Ham], c.Totals[Ham])
+	}
+
+	m.HamBow = Bow{"free": 1}
+	if err := NewClassifier().fromModel(m); err == nil {
+		t.Error("loaded a hashed model counting a word rather than a bucket")
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"html"
+	"regexp"
+)
+
+var (
+	htmlCommentRe = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlHiddenRe  = regexp.MustCompile(`(?is)<(script|style)\b.*?</(script|style)\s*>`)
+	htmlTagRe     = regexp.MustCompile(`<[a-zA-Z/!][^>]*>`)
+)
+
+// stripHTML reduces an HTML document to its visible text: comments, scripts,
+// styles and tags (with their attributes) are replaced by spaces and entities
+// like &amp; are decoded. A '<' that doesn't start a tag, as in "a < b", is
+// left alone.
+func stripHTML(content []byte) []byte {
+	content = htmlCommentRe.ReplaceAll(content, []byte(" "))
+	content = htmlHiddenRe.ReplaceAll(content, []byte(" "))
+	content = htmlTagRe.ReplaceAll(content, []byte(" "))
+	return []byte(html.UnescapeString(string(content)))
+}
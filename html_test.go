@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const htmlMessage = `<html>
+<head><style>body { color: #ff0000; }</style></head>
+<body>
+<!-- tracking id 12345 -->
+<div style="font-size: 20px"><b>Cheap</b> pills &amp; <a href="http://example.com/buy">more</a></div>
+<script>document.write("hidden")</script>
+<p>Only &pound;5 &mdash; 3 &lt; 4</p>
+</body>
+</html>`
+
+func TestStripHTML(t *testing.T) {
+	got := strings.Join(strings.Fields(string(stripHTML([]byte(htmlMessage)))), " ")
+	want := "Cheap pills & more Only £5 — 3 < 4"
+	if got != want {
+		t.Errorf("text of the HTML message is %q, want %q", got, want)
+	}
+}
+
+func TestClassifierStripHTML(t *testing.T) {
+	c := NewClassifier()
+	c.MinWordFreq = 1
+	c.StripHTML = true
+	if err := c.AddDocument(htmlMessage, Spam); err != nil {
+		t.Fatal(err)
+	}
+	for _, word := range []string{"div", "style", "href", "#ff0000", "hidden", "amp"} {
+		if n := c.wordCount(word); n != 0 {
+			t.Errorf("%s counted %d times, want markup left out", word, n)
+		}
+	}
+	if n := c.wordCount("pills"); n != 1 {
+		t.Errorf("pills counted %d times, want 1", n)
+	}
+}
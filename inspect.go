@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WordScore pairs a vocabulary word with its log-odds ratio
+// log(P(word|spam) / P(word|ham)); positive means spammy. Like everything
+// else in this file it needs a Classifier with the classes Ham and Spam.
+type WordScore struct {
+	Word    string
+	LogOdds float64
+}
+
+// logOdds uses the same smoothed likelihoods as classification, so words seen
+// in only one class get a finite score.
+func (c *Classifier) logOdds(word string) float64 {
+	spam := smoothedLikelihood(c.counts(Spam).count(word), c.Totals[Spam], c.VocabSize, c.Alpha)
+	ham := smoothedLikelihood(c.counts(Ham).count(word), c.Totals[Ham], c.VocabSize, c.Alpha)
+	return math.Log(spam) - math.Log(ham)
+}
+
+// scoredWords returns every word that passes MinWordFreq with its log-odds,
+// most spammy first. For a hashed model, call it on wordView.
+func (c *Classifier) scoredWords() []WordScore {
+	var scores []WordScore
+	seen := make(map[string]bool)
+	for _, bow := range []Bow{c.Bows[Spam], c.Bows[Ham]} {
+		for word := range bow {
+			if seen[word] || c.wordCount(word) < c.MinWordFreq {
+				continue
+			}
+			seen[word] = true
+			scores = append(scores, WordScore{Word: word, LogOdds: c.logOdds(word)})
+		}
+	}
+
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].LogOdds != scores[j].LogOdds {
+			return scores[i].LogOdds > scores[j].LogOdds
+		}
+		return scores[i].Word < scores[j].Word
+	})
+	return scores
+}
+
+// WordStats is what a model knows about one token.
+type WordStats struct {
+	Token     string
+	SpamCount int
+	HamCount  int
+	LogOdds   float64
+
+	// Counted is whether the token occurs at least MinWordFreq times, i.e.
+	// whether scoring uses it at all.
+	Counted bool
+}
+
+// WordStats looks word up after the same normalization, case folding,
+// stemming and hashing training applied, so "FREE" finds "free"; in a hashed
+// model Token is the name of its bucket. It fails if the tokenizer drops
+// word or splits it into several tokens.
+func (c *Classifier) WordStats(word string) (WordStats, error) {
+	// Load replaces the tokenizer settings along with the Bows, so look the
+	// token up under the same lock it was made under.
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	tokens := c.tokenize(word)
+	switch len(tokens) {
+	case 0:
+		return WordStats{}, fmt.Errorf("%q is dropped by the tokenizer", word)
+	case 1:
+	default:
+		return WordStats{}, fmt.Errorf("%q is %d tokens, not one: %s", word, len(tokens), strings.Join(tokens, " "))
+	}
+
+	if err := c.checkBinary(); err != nil {
+		return WordStats{}, err
+	}
+	token := tokens[0]
+	stats := WordStats{
+		Token:     token,
+		SpamCount: c.counts(Spam).count(token),
+		HamCount:  c.counts(Ham).count(token),
+		LogOdds:   c.logOdds(token),
+		Counted:   c.wordCount(token) >= c.MinWordFreq,
+	}
+	if c.HashBuckets > 0 {
+		stats.Token = bucketName(bucketIndex(token, c.HashBuckets))
+	}
+	return stats, nil
+}
+
+// WordCount is a word with how often it occurs in one class.
+type WordCount struct {
+	Word  string `json:"word"`
+	Count int    `json:"count"`
+}
+
+// ClassVocabulary returns the words of class label that pass MinWordFreq with
+// their counts in that class, most frequent first, e.g. for a word cloud. n
+// limits it to the n most frequent; 0 returns them all. Unlike the rest of
+// this file it works with any classes.
+func (c *Classifier) ClassVocabulary(label string, n int) ([]WordCount, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if _, ok := c.Bows[label]; !ok {
+		return nil, fmt.Errorf("unknown label %q", label)
+	}
+
+	view := c.wordView()
+	var counts []WordCount
+	for word, count := range view.Bows[label] {
+		if view.wordCount(word) >= c.MinWordFreq {
+			counts = append(counts, WordCount{Word: word, Count: count})
+		}
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Word < counts[j].Word
+	})
+	if n > 0 && n < len(counts) {
+		counts = counts[:n]
+	}
+	return counts, nil
+}
+
+// WriteWordCountsCSV writes counts as word,count rows under a header.
+func WriteWordCountsCSV(w io.Writer, counts []WordCount) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"word", "count"})
+	for _, count := range counts {
+		out.Write([]string{count.Word, strconv.Itoa(count.Count)})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// TopWords returns the n most spam-indicative and the n most ham-indicative
+// words, each list ordered from strongest to weakest.
+func (c *Classifier) TopWords(n int) ([]WordScore, []WordScore) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	scores := c.wordView().scoredWords()
+	n = max(0, min(n, len(scores)))
+
+	spammy := append([]WordScore(nil), scores[:n]...)
+	hammy := make([]WordScore, 0, n)
+	for i := len(scores) - 1; i >= len(scores)-n; i-- {
+		hammy = append(hammy, scores[i])
+	}
+	return spammy, hammy
+}
+
+// ExplainReader lists how much each scored word of the message read from r
+// pushed it towards spam (positive) or ham (negative), strongest first.
+func (c *Classifier) ExplainReader(r io.Reader) ([]WordScore, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	fileBow := make(Bow)
+	if err := c.addReaderToBow(r, fileBow); err != nil {
+		return nil, err
+	}
+	if err := c.checkBinary(); err != nil {
+		return nil, err
+	}
+	var contributions []WordScore
+	c.eachScoredWord(fileBow, func(word string, weight float64, logSpam float64, logHam float64) {
+		contributions = append(contributions, WordScore{Word: word, LogOdds: weight * (logSpam - logHam)})
+	})
+
+	sort.Slice(contributions, func(i, j int) bool {
+		a, b := math.Abs(contributions[i].LogOdds), math.Abs(contributions[j].LogOdds)
+		if a != b {
+			return a > b
+		}
+		return contributions[i].Word < contributions[j].Word
+	})
+	return contributions, nil
+}
+
+func (c *Classifier) ExplainFile(path string) ([]WordScore, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return c.ExplainReader(f)
+}
+
+// FeatureScore pairs a vocabulary word with its chi-squared statistic against
+// the spam/ham labels: how unlikely its counts would be if the word said
+// nothing about the class. Spammy tells which class it points to.
+type FeatureScore struct {
+	Word   string
+	Chi2   float64
+	Spammy bool
+}
+
+// chiSquared is the Pearson statistic of the 2x2 table of spam and ham
+// events with and without the word. For Bernoulli models the events are
+// training messages, since the Bows hold per-class document frequencies; for
+// multinomial models they are word occurrences.
+func (c *Classifier) chiSquared(word string) float64 {
+	spamWith, hamWith := float64(c.counts(Spam).count(word)), float64(c.counts(Ham).count(word))
+	spamEvents, hamEvents := float64(c.Totals[Spam]), float64(c.Totals[Ham])
+	if c.EventModel == Bernoulli {
+		spamEvents, hamEvents = float64(c.Docs[Spam]), float64(c.Docs[Ham])
+	}
+	spamWithout, hamWithout := spamEvents-spamWith, hamEvents-hamWith
+
+	with, without := spamWith+hamWith, spamWithout+hamWithout
+	denominator := spamEvents * hamEvents * with * without
+	if denominator == 0 {
+		return 0
+	}
+	diff := spamWith*hamWithout - hamWith*spamWithout
+	return (spamEvents + hamEvents) * diff * diff / denominator
+}
+
+// TopFeatures returns the n words that pass MinWordFreq with the highest
+// chi-squared statistic, strongest first, e.g. to pick the terms worth
+// keeping in a smaller model.
+func (c *Classifier) TopFeatures(n int) []FeatureScore {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.topFeatures(n)
+}
+
+func (c *Classifier) topFeatures(n int) []FeatureScore {
+	if view := c.wordView(); view != c {
+		return view.topFeatures(n)
+	}
+	scores := c.scoredWords()
+	features := make([]FeatureScore, len(scores))
+	for i, score := range scores {
+		features[i] = FeatureScore{Word: score.Word, Chi2: c.chiSquared(score.Word), Spammy: score.LogOdds > 0}
+	}
+
+	sort.Slice(features, func(i, j int) bool {
+		if features[i].Chi2 != features[j].Chi2 {
+			return features[i].Chi2 > features[j].Chi2
+		}
+		return features[i].Word < features[j].Word
+	})
+	return features[:min(n, len(features))]
+}
+
+// KeepTopFeatures drops every word but the k of TopFeatures from the Bows and
+// DocFreq and returns how many it dropped. Unlike Prune this changes
+// classification: the dropped words no longer count towards the totals
+// either, so the model scores messages on the kept words alone.
+func (c *Classifier) KeepTopFeatures(k int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keep := make(map[string]bool, k)
+	for _, feature := range c.topFeatures(k) {
+		keep[feature.Word] = true
+	}
+	if c.HashBuckets > 0 {
+		dropped := c.clearBuckets(func(i int, _ int) bool { return !keep[bucketName(i)] })
+		c.updateTotals()
+		return dropped
+	}
+	dropped := 0
+	for _, bow := range c.Bows {
+		for word := range bow {
+			if keep[word] {
+				continue
+			}
+			// Deleting from every Bow counts a word seen in several only once.
+			c.deleteWord(word)
+			dropped++
+		}
+	}
+	c.updateTotals()
+	return dropped
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestTopWords(t *testing.T) {
+	c := trainedClassifier(t)
+	vocab := len(c.scoredWords())
+	for _, test := range []struct {
+		n, want int
+	}{
+		{-1, 0},
+		{0, 0},
+		{2, 2},
+		{vocab + 10, vocab},
+	} {
+		spammy, hammy := c.TopWords(test.n)
+		if len(spammy) != test.want || len(hammy) != test.want {
+			t.Errorf("TopWords(%d) listed %d and %d words, want %d each", test.n, len(spammy), len(hammy), test.want)
+		}
+		if test.want > 0 && spammy[0].LogOdds < hammy[0].LogOdds {
+			t.Errorf("TopWords(%d) put %s above %s", test.n, hammy[0].Word, spammy[0].Word)
+		}
+	}
+}
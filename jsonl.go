@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// JSONLFields names the fields TrainJSONL takes the label and the message
+// text of each line from.
+type JSONLFields struct {
+	Label string
+	Text  string
+}
+
+// DefaultJSONLFields reads lines like {"label":"spam","text":"..."}.
+var DefaultJSONLFields = JSONLFields{Label: "label", Text: "text"}
+
+// eachJSONLRecord calls fn with the line number, label and text of every
+// non-blank line of a JSON Lines stream. Labels are lowercased.
+func eachJSONLRecord(r io.Reader, fields JSONLFields, fn func(line int, label string, text string) error) error {
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		content, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(content)) > 0 {
+			label, text, parseErr := parseJSONLRecord(content, fields)
+			if parseErr != nil {
+				return fmt.Errorf("line %d: %w", line, parseErr)
+			}
+			if err := fn(line, label, text); err != nil {
+				return err
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func parseJSONLRecord(content []byte, fields JSONLFields) (string, string, error) {
+	var record map[string]json.RawMessage
+	if err := json.Unmarshal(content, &record); err != nil {
+		return "", "", err
+	}
+	var label, text string
+	for _, field := range []struct {
+		name  string
+		value *string
+	}{{fields.Label, &label}, {fields.Text, &text}} {
+		raw, ok := record[field.name]
+		if !ok {
+			return "", "", fmt.Errorf("no %q field", field.name)
+		}
+		if err := json.Unmarshal(raw, field.value); err != nil {
+			return "", "", fmt.Errorf("field %q: %w", field.name, err)
+		}
+	}
+	return strings.ToLower(strings.TrimSpace(label)), text, nil
+}
+
+// TrainJSONL trains on a JSON Lines file with one labeled message per line,
+// which unlike CSV needs no quoting rules for multi-line messages.
+func (c *Classifier) TrainJSONL(path string, fields JSONLFields) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r, err := decompress(f)
+	if err != nil {
+		return err
+	}
+
+	messages := 0
+	err = eachJSONLRecord(r, fields, func(line int, label string, text string) error {
+		bow, err := c.bowFor(label)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		added, err := c.addTrainingReader(strings.NewReader(text), bow, c.docFreq())
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if !added {
+			return nil
+		}
+		c.countDocs(label, 1)
+		messages++
+		return nil
+	})
+	if err != nil {
+		// The lines before the error are counted already.
+		c.updateTotals()
+		return err
+	}
+
+	c.updateTotals()
+	c.logger().Info("trained", "jsonl", path, "messages", messages)
+	return nil
+}
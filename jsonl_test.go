@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestTrainJSONLKeepsTotalsOnError(t *testing.T) {
+	path := writeFile(t, "train.jsonl", `{"label": "spam", "text": "free money now"}
+{"label": "ham", "text": "lunch with the team"}
+{"label": "spam", "text":
+`)
+	c := NewClassifier()
+	c.MinWordFreq = 1
+	if err := c.TrainJSONL(path, DefaultJSONLFields); err == nil {
+		t.Fatal("TrainJSONL accepted a truncated line")
+	}
+	if c.Docs[Spam] != 1 || c.Docs[Ham] != 1 {
+		t.Errorf("trained %v before the bad line, want one message of each", c.Docs)
+	}
+	checkTotals(t, c)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// EmailToken is the token email addresses become with Tokenizer.Links.
+const EmailToken = "<EMAIL>"
+
+var (
+	// urlPattern captures the host of a URL: scheme://[user@]host or a bare
+	// www.host, wherever it starts in a word, so href="http://..." counts.
+	urlPattern   = regexp.MustCompile(`(?i)(?:\b[a-z][a-z0-9+.-]*://(?:[^/@\s]*@)?|\bwww\.)([a-z0-9-]+(?:\.[a-z0-9-]+)*)`)
+	emailPattern = regexp.MustCompile(`(?i)[a-z0-9._%+-]+@[a-z0-9-]+(?:\.[a-z0-9-]+)*\.[a-z]{2,}`)
+)
+
+// linkFeature returns the Tokenizer.Links feature for word, if it holds a
+// URL or an email address.
+func linkFeature(word string) (string, bool) {
+	if match := urlPattern.FindStringSubmatch(word); match != nil {
+		host := strings.ToLower(match[1])
+		if strings.HasPrefix(strings.ToLower(match[0]), "www.") {
+			host = "www." + host
+		}
+		return "<URL:" + host + ">", true
+	}
+	if emailPattern.MatchString(word) {
+		return EmailToken, true
+	}
+	return "", false
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTokenizeLinks(t *testing.T) {
+	tokenizer := DefaultTokenizer()
+	tokenizer.Links = true
+	for _, test := range []struct {
+		name    string
+		message string
+		want    []string
+	}{
+		{
+			"http",
+			"Click http://Example.COM/buy?id=1 now",
+			[]string{"click", "<URL:example.com>", "now"},
+		},
+		{
+			"https with user and port",
+			"Log in at https://user@secure.bank.co.uk:443/login, today",
+			[]string{"log", "in", "at", "<URL:secure.bank.co.uk>", "today"},
+		},
+		{
+			"bare www host",
+			"visit www.Pills.biz/cheap!",
+			[]string{"visit", "<URL:www.pills.biz>"},
+		},
+		{
+			"inside markup",
+			`<a href="HTTP://track.spam.net/x?u=1">here</a>`,
+			[]string{"<a", "<URL:track.spam.net>"},
+		},
+		{
+			"email",
+			"Mail sales@shop.example.org or (Bob.Smith+news@example.com).",
+			[]string{"mail", "<EMAIL>", "or", "<EMAIL>"},
+		},
+		{
+			// Without a scheme or www. a dotted word could as well be a file
+			// name, so it stays a word.
+			"no scheme",
+			"see example.com and notes.txt",
+			[]string{"see", "example.com", "and", "notes.txt"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := tokenizer.Tokenize(test.message); !slices.Equal(got, test.want) {
+				t.Errorf("Tokenize(%q) = %q, want %q", test.message, got, test.want)
+			}
+		})
+	}
+}
@@ -1,174 +1,1290 @@
-// Naive Bayes Spam Classifier
-//
-//   P(spam|words) = P(words|spam) * P(spam) / P(words)
-//     posterior    =  likelihood   *  prior  / evidence
-//
-//   prior      — how common spam/ham is overall (spamCount / totalCount)
-//   likelihood — probability of seeing these words given it's spam (or ham)
-//   evidence   — probability of seeing these words regardless of class
-//   posterior   — final score: how likely the email is spam (or ham)
-//
-//   We use log() on everything so we can add instead of multiply,
-//   which avoids floating-point underflow with many small probabilities.
-
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io/fs"
-	"math"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
-type Bow map[string]int
+// stringList is a flag.Value that collects every occurrence of a repeatable flag.
+type stringList []string
 
-const MinWordFreq = 100
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
 
-func addFileToBow(path string, bow Bow) error {
-	content, err := os.ReadFile(path)
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// ngramFlag is the value of --ngram: the longest n-gram, the n-gram sizes
+// spelled out as in "1,2", or "mixed" for words plus bigrams. Shorter
+// n-grams and the words themselves are always emitted too.
+type ngramFlag int
+
+func (n *ngramFlag) String() string {
+	return strconv.Itoa(int(*n))
+}
 
+func (n *ngramFlag) Set(value string) error {
+	if value == "mixed" {
+		*n = 2
+		return nil
+	}
+	sizes := strings.Split(value, ",")
+	for i, size := range sizes {
+		v, err := strconv.Atoi(strings.TrimSpace(size))
+		if err != nil {
+			return fmt.Errorf("want a number, a list like 1,2 or mixed, got %q", value)
+		}
+		if len(sizes) > 1 && v != i+1 {
+			return fmt.Errorf("n-gram sizes must run 1,2,... since the words are always included, got %q", value)
+		}
+		*n = ngramFlag(v)
+	}
+	return nil
+}
+
+// extOptions are the flags that pick files from directories by extension.
+type extOptions struct {
+	include stringList
+	exclude stringList
+}
+
+func (o *extOptions) register(fs *flag.FlagSet) {
+	fs.Var(&o.include, "include-ext", "only read files with these extensions from directories, e.g. txt,eml (repeatable)")
+	fs.Var(&o.exclude, "exclude-ext", "skip files with these extensions in directories (repeatable)")
+}
+
+func (o *extOptions) apply(classifier *Classifier) {
+	classifier.Extensions = ExtFilter{Include: splitList(o.include), Exclude: splitList(o.exclude)}
+}
+
+// splitList splits every comma-separated value of l.
+func splitList(l stringList) []string {
+	var values []string
+	for _, value := range l {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+var defaultTrainDirs = []string{
+	"data/enron1",
+	"data/enron2",
+	"data/enron3",
+	"data/enron4",
+	"data/enron5",
+}
+
+var defaultEvalDir = "data/enron6"
+
+// trainOptions are the flags shared by every subcommand that trains a model.
+type trainOptions struct {
+	trainDirs     stringList
+	hamSubdir     string
+	spamSubdir    string
+	parseEmail    bool
+	subjectWeight float64
+	stripHTML     bool
+	stripQuotes   bool
+	dedup         bool
+	trainMbox     stringList
+	trainHamTar   stringList
+	trainSpamTar  stringList
+	mboxLabel     string
+	trainCSV      stringList
+	csvLabelCol   string
+	csvTextCol    string
+	csvHeader     bool
+	trainJSONL    stringList
+	jsonlLabel    string
+	jsonlText     string
+	casing        string
+	ngram         ngramFlag
+	stopWords     bool
+	stopWordsFile string
+	stem          bool
+	minTokenLen   int
+	maxTokenLen   int
+	normalize     bool
+	stripMarks    bool
+	numbers       bool
+	links         bool
+	charNGram     int
+	minWordFreq   int
+	alpha         float64
+	hashBuckets   int
+	tfidf         bool
+	eventModel    string
+	prior         string
+	spamWeight    float64
+	hamWeight     float64
+	workers       int
+	binaryRatio   float64
+	maxFileSize   int64
+	failFast      bool
+	verbose       bool
+	ext           extOptions
+
+	// quiet leaves out the progress line, for output that must stay JSON.
+	quiet bool
+}
+
+func (o *trainOptions) register(fs *flag.FlagSet) {
+	fs.Var(&o.trainDirs, "train-dir", "corpus directory containing ham and spam subdirectories (repeatable)")
+	fs.StringVar(&o.hamSubdir, "ham-subdir", DefaultCorpusLayout.HamSubdir, "name of the ham subdirectory inside each training directory")
+	fs.StringVar(&o.spamSubdir, "spam-subdir", DefaultCorpusLayout.SpamSubdir, "name of the spam subdirectory inside each training directory")
+	fs.BoolVar(&o.parseEmail, "eml", false, "parse messages as .eml/MIME and tokenize only the decoded text body")
+	fs.Float64Var(&o.subjectWeight, "subject-weight", DefaultSubjectWeight, "count subject tokens this many times (with --eml)")
+	fs.BoolVar(&o.stripHTML, "strip-html", false, "strip HTML tags and decode entities before tokenizing")
+	fs.BoolVar(&o.stripQuotes, "strip-quotes", false, "drop quoted reply lines starting with > and signatures after a \"-- \" line before tokenizing")
+	fs.BoolVar(&o.dedup, "dedup", false, "train on byte-identical messages only once")
+	fs.Var(&o.trainMbox, "train-mbox", "mbox file to train on, labeled by --label (repeatable)")
+	fs.StringVar(&o.mboxLabel, "label", "", "label of the --train-mbox messages: ham or spam")
+	fs.Var(&o.trainHamTar, "train-ham-tar", "tar or .tar.gz archive of ham messages to train on (repeatable)")
+	fs.Var(&o.trainSpamTar, "train-spam-tar", "tar or .tar.gz archive of spam messages to train on (repeatable)")
+	fs.Var(&o.trainCSV, "train-csv", "CSV file with one labeled message per row to train on (repeatable)")
+	fs.StringVar(&o.csvLabelCol, "csv-label-col", "0", "index or header name of the --train-csv label column")
+	fs.StringVar(&o.csvTextCol, "csv-text-col", "1", "index or header name of the --train-csv message column")
+	fs.BoolVar(&o.csvHeader, "csv-header", false, "skip the first --train-csv row as a header (implied by column names)")
+	fs.Var(&o.trainJSONL, "train-jsonl", "JSON Lines file with one labeled message per line to train on (repeatable)")
+	fs.StringVar(&o.jsonlLabel, "jsonl-label-field", DefaultJSONLFields.Label, "name of the --train-jsonl label field")
+	fs.StringVar(&o.jsonlText, "jsonl-text-field", DefaultJSONLFields.Text, "name of the --train-jsonl message field")
+	fs.StringVar(&o.casing, "casing", string(CaseLower), "token case folding: lower, upper or preserve")
+	o.ngram = 1
+	fs.Var(&o.ngram, "ngram", "also emit runs of up to N adjacent words as features; 2, also written 1,2 or mixed, adds bigrams to the words")
+	fs.BoolVar(&o.stopWords, "stop-words", false, "drop common English stop words")
+	fs.StringVar(&o.stopWordsFile, "stop-words-file", "", "drop the stop words listed in this file instead of the built-in list")
+	fs.BoolVar(&o.stem, "stem", false, "reduce words to their Porter stem")
+	fs.IntVar(&o.minTokenLen, "min-token-len", 2, "drop words shorter than this many characters")
+	fs.IntVar(&o.maxTokenLen, "max-token-len", 0, "drop words longer than this many characters (0 = no limit)")
+	fs.BoolVar(&o.normalize, "normalize", true, "fold Unicode look-alikes (fullwidth, math letters, ligatures) to their plain form")
+	fs.BoolVar(&o.stripMarks, "strip-marks", false, "remove accents and other combining marks")
+	fs.IntVar(&o.charNGram, "char-ngram", 0, "count runs of N characters, ignoring spaces and punctuation, instead of words (0 = words)")
+	fs.BoolVar(&o.links, "links", false, "count URLs as <URL:host> and email addresses as <EMAIL> tokens")
+	fs.BoolVar(&o.numbers, "numbers", false, "count every number-like word (prices, phone numbers, dates) as a single <NUM> token")
+	fs.IntVar(&o.hashBuckets, "hash-buckets", 0, fmt.Sprintf("count words in this many hashed buckets to bound memory, e.g. %d (0 = keep every word)", DefaultHashBuckets))
+	fs.Float64Var(&o.alpha, "alpha", DefaultAlpha, "additive smoothing constant of the word likelihoods")
+	fs.IntVar(&o.minWordFreq, "min-word-freq", DefaultMinWordFreq, "ignore words occurring fewer times than this across the training corpus")
+	fs.StringVar(&o.eventModel, "model", string(Multinomial), "event model: multinomial (word counts) or bernoulli (word presence)")
+	fs.StringVar(&o.prior, "prior", string(PriorEmpirical), "class priors: empirical (share of training messages) or uniform")
+	fs.Float64Var(&o.spamWeight, "spam-weight", 1, "scale the spam prior by this, e.g. below 1 to flag less ham as spam")
+	fs.Float64Var(&o.hamWeight, "ham-weight", 1, "scale the ham prior by this")
+	fs.BoolVar(&o.tfidf, "tfidf", false, "weight the words of classified messages by TF-IDF learned from the training corpus")
+	fs.IntVar(&o.workers, "workers", 0, "files to process in parallel (0 = GOMAXPROCS)")
+	fs.Int64Var(&o.maxFileSize, "max-file-size", DefaultMaxFileSize, "skip training files larger than this many bytes (0 = no limit)")
+	fs.BoolVar(&o.failFast, "fail-fast", false, "stop at the first unreadable training file instead of warning and going on")
+	fs.BoolVar(&o.verbose, "verbose", false, "log every training file and a summary per training source to stderr")
+	o.ext.register(fs)
+	fs.Float64Var(&o.binaryRatio, "binary-threshold", DefaultBinaryRatio, "skip training files whose first 8 KB are more than this share of control or non-UTF-8 bytes (1 = keep all)")
+}
+
+// configure applies the tokenizer and reader settings to classifier.
+func (o *trainOptions) configure(classifier *Classifier) error {
+	classifier.ParseEmail = o.parseEmail
+	if o.subjectWeight <= 0 {
+		return fmt.Errorf("--subject-weight must be positive, got %v", o.subjectWeight)
+	}
+	classifier.SubjectWeight = o.subjectWeight
+	classifier.StripHTML = o.stripHTML
+	classifier.StripQuotes = o.stripQuotes
+	classifier.Dedup = o.dedup
+	casing, err := parseCasing(o.casing)
+	if err != nil {
+		return err
+	}
+	classifier.Tokenizer.Casing = casing
+	if o.ngram < 1 {
+		return fmt.Errorf("--ngram must be at least 1, got %d", o.ngram)
+	}
+	classifier.Tokenizer.NGram = int(o.ngram)
+	if o.stopWordsFile != "" {
+		words, err := loadStopWords(o.stopWordsFile)
+		if err != nil {
+			return err
+		}
+		classifier.Tokenizer.SetStopWords(words)
+	} else if o.stopWords {
+		classifier.Tokenizer.SetStopWords(EnglishStopWords)
+	}
+	classifier.Tokenizer.Stem = o.stem
+	if o.minTokenLen < 0 || o.maxTokenLen < 0 || (o.maxTokenLen > 0 && o.maxTokenLen < o.minTokenLen) {
+		return fmt.Errorf("invalid token length range %d..%d", o.minTokenLen, o.maxTokenLen)
+	}
+	classifier.Tokenizer.MinLength = o.minTokenLen
+	classifier.Tokenizer.MaxLength = o.maxTokenLen
+	classifier.Tokenizer.Normalize = o.normalize
+	classifier.Tokenizer.StripMarks = o.stripMarks
+	classifier.Tokenizer.Numbers = o.numbers
+	classifier.Tokenizer.Links = o.links
+	if o.charNGram < 0 {
+		return fmt.Errorf("--char-ngram must not be negative, got %d", o.charNGram)
+	}
+	classifier.Tokenizer.CharNGram = o.charNGram
+	if o.minWordFreq < 1 {
+		return fmt.Errorf("--min-word-freq must be at least 1, got %d", o.minWordFreq)
+	}
+	classifier.MinWordFreq = o.minWordFreq
+	if o.alpha <= 0 {
+		return fmt.Errorf("--alpha must be positive, got %v", o.alpha)
+	}
+	classifier.Alpha = o.alpha
+	if o.hashBuckets < 0 {
+		return fmt.Errorf("--hash-buckets must not be negative, got %d", o.hashBuckets)
+	}
+	classifier.HashBuckets = o.hashBuckets
+	eventModel, err := parseEventModel(o.eventModel)
+	if err != nil {
+		return err
+	}
+	classifier.EventModel = eventModel
+	prior, err := parsePrior(o.prior)
 	if err != nil {
 		return err
 	}
+	classifier.Prior = prior
+	if o.spamWeight <= 0 || o.hamWeight <= 0 {
+		return fmt.Errorf("--spam-weight and --ham-weight must be positive, got %v and %v", o.spamWeight, o.hamWeight)
+	}
+	classifier.SpamWeight = o.spamWeight
+	classifier.HamWeight = o.hamWeight
+	classifier.TFIDF = o.tfidf
+	classifier.Workers = o.workers
+	classifier.BinaryRatio = o.binaryRatio
+	if o.maxFileSize < 0 {
+		return fmt.Errorf("--max-file-size must not be negative, got %d", o.maxFileSize)
+	}
+	classifier.MaxFileSize = o.maxFileSize
+	classifier.FailFast = o.failFast
+	level := slog.LevelWarn
+	if o.verbose {
+		level = slog.LevelDebug
+	}
+	classifier.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	o.ext.apply(classifier)
+	return nil
+}
 
-	for _, token := range tokenize(string(content)) {
-		bow[token] += 1
+func (o *trainOptions) layout() CorpusLayout {
+	return CorpusLayout{HamSubdir: o.hamSubdir, SpamSubdir: o.spamSubdir}
+}
+
+func (o *trainOptions) train(classifier *Classifier) error {
+	if err := o.configure(classifier); err != nil {
+		return err
 	}
 
+	trainDirs := o.trainDirs
+	if len(trainDirs) == 0 && len(o.trainMbox) == 0 && len(o.trainHamTar) == 0 && len(o.trainSpamTar) == 0 && len(o.trainCSV) == 0 && len(o.trainJSONL) == 0 {
+		trainDirs = defaultTrainDirs
+	}
+
+	if !o.quiet {
+		fmt.Println(">> training <<")
+	}
+	for _, dir := range trainDirs {
+		// Unreadable files have been logged; train on the rest.
+		err := classifier.TrainCorpus(dir, o.layout())
+		var fileErrs FileErrors
+		if err != nil && !errors.As(err, &fileErrs) {
+			return err
+		}
+	}
+
+	for _, path := range o.trainMbox {
+		if err := classifier.TrainMbox(path, o.mboxLabel); err != nil {
+			return fmt.Errorf("training mbox %q: %w", path, err)
+		}
+	}
+
+	for _, tars := range []struct {
+		paths stringList
+		label string
+	}{{o.trainHamTar, Ham}, {o.trainSpamTar, Spam}} {
+		for _, path := range tars.paths {
+			if err := classifier.TrainTar(path, tars.label); err != nil {
+				return fmt.Errorf("training tar %q: %w", path, err)
+			}
+		}
+	}
+
+	columns := CSVColumns{Label: o.csvLabelCol, Text: o.csvTextCol, Header: o.csvHeader}
+	for _, path := range o.trainCSV {
+		if err := classifier.TrainCSV(path, columns); err != nil {
+			return fmt.Errorf("training csv %q: %w", path, err)
+		}
+	}
+
+	fields := JSONLFields{Label: o.jsonlLabel, Text: o.jsonlText}
+	for _, path := range o.trainJSONL {
+		if err := classifier.TrainJSONL(path, fields); err != nil {
+			return fmt.Errorf("training jsonl %q: %w", path, err)
+		}
+	}
+
+	if o.dedup && !o.quiet {
+		fmt.Printf(">> skipped %d duplicate messages <<\n", classifier.Duplicates)
+	}
 	return nil
 }
 
-func addDirToBow(path string, bow Bow) error {
-	return filepath.WalkDir(path, func(path string, d os.DirEntry, err error) error {
-		if d.IsDir() {
-			return nil
-		}
+// decisionOptions are the flags of every subcommand that labels messages.
+type decisionOptions struct {
+	threshold    float64
+	unsureMargin float64
+}
+
+func (o *decisionOptions) register(fs *flag.FlagSet) {
+	fs.Float64Var(&o.threshold, "threshold", DefaultThreshold, "label a message spam when P(spam) is at least this")
+	fs.Float64Var(&o.unsureMargin, "unsure-margin", 0, "label a message unsure when P(spam) is less than this far from --threshold")
+}
+
+func (o *decisionOptions) apply(classifier *Classifier) error {
+	if o.threshold < 0 || o.threshold > 1 {
+		return fmt.Errorf("--threshold must be between 0 and 1, got %v", o.threshold)
+	}
+	classifier.Threshold = o.threshold
+	if o.unsureMargin < 0 {
+		return fmt.Errorf("--unsure-margin must not be negative, got %v", o.unsureMargin)
+	}
+	classifier.UnsureMargin = o.unsureMargin
+	return nil
+}
 
-		if err := addFileToBow(path, bow); err != nil {
+func classifyDirs(classifier *Classifier, dirs []string) error {
+	for _, dir := range dirs {
+		fmt.Printf(">> classify %s <<\n", dir)
+		results, err := classifier.ClassifyDirResults(dir)
+		if err != nil {
 			return err
 		}
-		return nil
-	})
+		summarize(results).print()
+	}
+	return nil
 }
 
-func classifyFile(filepath string, hamBow Bow, hamTotal int, spamBow Bow, spamTotal int) (float64, float64, error) {
-	totalCount := hamTotal + spamTotal
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage:\n")
+	fmt.Fprintf(os.Stderr, "  %s [flags]                 train and classify in one run\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s train --out model.gob   train and save a model\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s classify --model model.gob --dir DIR | -\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s learn --model model.gob --label spam FILE...\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s evaluate --model model.gob --dir DIR\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s crossval --k 5 --seed 1 [--train-dir DIR]...\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s inspect --model model.gob --top 20\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s serve --model model.gob --addr :8080\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s merge --out model.gob MODEL...\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s stats [--train-dir DIR]...\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s compare --model-a a.gob --model-b b.gob --test-dir DIR\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s repl --model model.gob     classify messages pasted on stdin\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\nRun '%s <subcommand> -h' for the flags of a subcommand. Every subcommand also\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "reads flags from a YAML file given with --config; the command line overrides it.\n")
+}
 
-	priorHam := float64(hamTotal) / float64(totalCount)
-	priorSpam := float64(spamTotal) / float64(totalCount)
+// runAll is the original workflow: train on the enron1-5 corpora and classify
+// enron6 unless told otherwise.
+func runAll(args []string) error {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	var opts trainOptions
+	opts.register(fs)
+	var decision decisionOptions
+	decision.register(fs)
+	var dirs stringList
+	fs.Var(&dirs, "classify-dir", "directory of emails to classify (repeatable)")
+	evalDir := fs.String("eval-dir", "", "labeled directory with ham and spam subdirectories to evaluate on (default data/enron6 when no --classify-dir is given)")
+	var evaluate evaluateOptions
+	evaluate.register(fs)
+	fs.Usage = func() {
+		usage()
+		fmt.Fprintf(os.Stderr, "\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
 
-	fileBow := make(Bow)
-	if err := addFileToBow(filepath, fileBow); err != nil {
-		return 0.0, 0.0, err
+	if len(dirs) == 0 && *evalDir == "" {
+		*evalDir = defaultEvalDir
 	}
 
-	logEvidence := 0.0
-	logLikelihoodSpam := 0.0
-	logLikelihoodHam := 0.0
-	for word := range fileBow {
+	classifier := NewClassifier()
+	if err := decision.apply(classifier); err != nil {
+		return err
+	}
+	if err := opts.train(classifier); err != nil {
+		return err
+	}
+	if err := classifyDirs(classifier, dirs); err != nil {
+		return err
+	}
+	if *evalDir != "" {
+		return evaluateDir(classifier, *evalDir, opts.layout(), evaluate)
+	}
+	return nil
+}
+
+// evaluateOptions are the flags of every subcommand that evaluates on a
+// labeled directory.
+type evaluateOptions struct {
+	reportCSV   string
+	showErrors  bool
+	maxErrors   int
+	minAccuracy float64
+}
 
-		totalWordFreq := spamBow[word] + hamBow[word]
+func (o *evaluateOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.reportCSV, "report-csv", "", "also write path,trueLabel,predLabel,pSpam for every evaluated file, then the confusion matrix, to this CSV file")
+	fs.BoolVar(&o.showErrors, "show-errors", false, "list the misclassified files, grouped into false positives and false negatives")
+	fs.IntVar(&o.maxErrors, "max-errors", 20, "list at most this many files of each group with --show-errors (0 = all)")
+	fs.Float64Var(&o.minAccuracy, "min-accuracy", 0, "fail if the accuracy is below this fraction, e.g. 0.95 (0 = never)")
+}
 
-		if totalWordFreq < MinWordFreq {
-			continue
+// evaluateDir prints the evaluation of classifier on dir, followed by the
+// misclassified files or the CSV report if opts asks for them.
+func evaluateDir(classifier *Classifier, dir string, layout CorpusLayout, opts evaluateOptions) error {
+	fmt.Printf(">> evaluate %s <<\n", dir)
+	e, files, err := classifier.EvaluateCorpusFiles(dir, layout)
+	if err != nil {
+		return err
+	}
+	return reportEvaluation(e, files, opts)
+}
+
+// reportEvaluation prints e, followed by the misclassified files or the CSV
+// report if opts asks for them, and fails below opts.minAccuracy.
+func reportEvaluation(e Evaluation, files []EvaluatedFile, opts evaluateOptions) error {
+	fmt.Println(e)
+	if opts.showErrors {
+		falsePositives, falseNegatives := Misclassified(files)
+		printMisclassified("false positives (ham labeled spam)", falsePositives, opts.maxErrors)
+		printMisclassified("false negatives (spam labeled ham)", falseNegatives, opts.maxErrors)
+	}
+	if opts.reportCSV != "" {
+		f, err := os.Create(opts.reportCSV)
+		if err != nil {
+			return err
+		}
+		if err := WriteEvaluationCSV(f, e, files); err != nil {
+			f.Close()
+			return fmt.Errorf("writing %q: %w", opts.reportCSV, err)
 		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	if e.Accuracy() < opts.minAccuracy {
+		return fmt.Errorf("accuracy %.2f%% is below --min-accuracy %.2f%%", 100*e.Accuracy(), 100*opts.minAccuracy)
+	}
+	return nil
+}
 
-		if spamBow[word] != 0 {
-			logLikelihoodSpam += math.Log(float64(spamBow[word]) / float64(spamTotal))
+func printMisclassified(title string, files []EvaluatedFile, limit int) {
+	fmt.Printf(">> %d %s <<\n", len(files), title)
+	for i, file := range files {
+		if limit > 0 && i == limit {
+			fmt.Printf("... and %d more\n", len(files)-limit)
+			break
 		}
+		fmt.Printf("%.4f %s\n", file.Probability, file.Path)
+	}
+}
+
+func runCrossValidate(args []string) error {
+	fs := flag.NewFlagSet("crossval", flag.ExitOnError)
+	var opts trainOptions
+	opts.register(fs)
+	k := fs.Int("k", 5, "number of folds")
+	seed := fs.Int64("seed", 1, "seed for shuffling files into folds")
+	holdout := fs.Float64("holdout", 0, "instead of folds, train once and evaluate on this share of the files, e.g. 0.2")
+	var decision decisionOptions
+	decision.register(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	classifier := NewClassifier()
+	if err := opts.configure(classifier); err != nil {
+		return err
+	}
+	if err := decision.apply(classifier); err != nil {
+		return err
+	}
 
-		if hamBow[word] != 0 {
-			logLikelihoodHam += math.Log(float64(hamBow[word]) / float64(hamTotal))
+	trainDirs := opts.trainDirs
+	if len(trainDirs) == 0 {
+		trainDirs = defaultTrainDirs
+	}
+	var files []LabeledFile
+	for _, dir := range trainDirs {
+		dirFiles, err := labeledFiles(dir, opts.layout(), classifier.Extensions)
+		if err != nil {
+			return err
 		}
+		files = append(files, dirFiles...)
+	}
 
-		if totalWordFreq != 0 {
-			logEvidence += math.Log(float64(totalWordFreq) / float64(totalCount))
+	if *holdout > 0 {
+		train, test, err := SplitLabeled(files, *holdout, *seed)
+		if err != nil {
+			return err
+		}
+		fmt.Printf(">> holdout: train on %d files, evaluate on %d <<\n", len(train), len(test))
+		model := classifier.emptyCopy()
+		var fileErrs FileErrors
+		if err := model.TrainLabeled(train); err != nil && !errors.As(err, &fileErrs) {
+			return err
+		}
+		e, err := model.EvaluateLabeled(test)
+		if err != nil {
+			return err
 		}
+		fmt.Println(e)
+		return nil
+	}
+
+	fmt.Printf(">> %d-fold cross-validation over %d files <<\n", *k, len(files))
+	cv, err := classifier.CrossValidate(files, *k, *seed)
+	if err != nil {
+		return err
 	}
+	fmt.Println(cv)
+	return nil
+}
 
-	spamScore := logLikelihoodSpam + priorSpam - logEvidence
-	hamScore := logLikelihoodHam + priorHam - logEvidence
+func runEvaluate(args []string) error {
+	fs := flag.NewFlagSet("evaluate", flag.ExitOnError)
+	modelPath := fs.String("model", "model.gob", "trained model to load")
+	dir := fs.String("dir", defaultEvalDir, "labeled directory with ham and spam subdirectories")
+	test := fs.String("test", "", "evaluate on this labeled CSV file instead of --dir")
+	csvLabelCol := fs.String("csv-label-col", "0", "index or header name of the --test label column")
+	csvTextCol := fs.String("csv-text-col", "1", "index or header name of the --test message column")
+	csvHeader := fs.Bool("csv-header", false, "skip the first --test row as a header (implied by column names)")
+	hamSubdir := fs.String("ham-subdir", DefaultCorpusLayout.HamSubdir, "name of the ham subdirectory")
+	spamSubdir := fs.String("spam-subdir", DefaultCorpusLayout.SpamSubdir, "name of the spam subdirectory")
+	workers := fs.Int("workers", 0, "files to classify in parallel (0 = GOMAXPROCS)")
+	var evaluate evaluateOptions
+	evaluate.register(fs)
+	var ext extOptions
+	ext.register(fs)
+	var decision decisionOptions
+	decision.register(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
 
-	return spamScore, hamScore, nil
+	classifier := NewClassifier()
+	if err := classifier.loadModelFile(*modelPath); err != nil {
+		return err
+	}
+	classifier.Workers = *workers
+	ext.apply(classifier)
+	if err := decision.apply(classifier); err != nil {
+		return err
+	}
+	if *test != "" {
+		fmt.Printf(">> evaluate %s <<\n", *test)
+		e, files, err := classifier.EvaluateCSV(*test, CSVColumns{Label: *csvLabelCol, Text: *csvTextCol, Header: *csvHeader})
+		if err != nil {
+			return err
+		}
+		return reportEvaluation(e, files, evaluate)
+	}
+	return evaluateDir(classifier, *dir, CorpusLayout{HamSubdir: *hamSubdir, SpamSubdir: *spamSubdir}, evaluate)
 }
 
-func classifyDir(dirPath string, hamBow Bow, hamTotal int, spamBow Bow, spamTotal int) (int, int, error) {
-	spamCount := 0
-	hamCount := 0
-	filepath.WalkDir(dirPath, func(path string, d fs.DirEntry, err error) error {
+func runInspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	modelPath := fs.String("model", "model.gob", "trained model to load")
+	top := fs.Int("top", 20, "how many words to list per class")
+	chi2 := fs.Int("chi2", 0, "list this many of the most discriminative words by chi-squared instead")
+	word := fs.String("word", "", "show the counts and log-odds of this word instead")
+	dumpVocab := fs.Bool("dump-vocab", false, "write the words of --class that pass the minimum word frequency with their counts, most frequent first, instead")
+	class := fs.String("class", Spam, "class whose words --dump-vocab writes")
+	limit := fs.Int("limit", 0, "with --dump-vocab, write only this many of the most frequent words (0 = all)")
+	format := fs.String("format", "csv", "--dump-vocab output format: csv or json")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *top < 0 {
+		return fmt.Errorf("--top must not be negative, got %d", *top)
+	}
+
+	classifier := NewClassifier()
+	if err := classifier.loadModelFile(*modelPath); err != nil {
+		return err
+	}
+
+	if *dumpVocab {
+		counts, err := classifier.ClassVocabulary(*class, *limit)
+		if err != nil {
+			return err
+		}
+		switch *format {
+		case "csv":
+			return WriteWordCountsCSV(os.Stdout, counts)
+		case "json":
+			if counts == nil {
+				counts = []WordCount{}
+			}
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(counts)
+		default:
+			return fmt.Errorf("inspect: unknown --format %q (want csv or json)", *format)
+		}
+	}
+	if err := classifier.checkBinary(); err != nil {
+		return fmt.Errorf("inspecting %q: %w", *modelPath, err)
+	}
 
-		if d.IsDir() {
+	if *word != "" {
+		stats, err := classifier.WordStats(*word)
+		if err != nil {
+			return err
+		}
+		fmt.Printf(">> word %s <<\n", stats.Token)
+		if stats.SpamCount+stats.HamCount == 0 {
+			fmt.Println("not in the vocabulary")
 			return nil
 		}
+		fmt.Printf("spam:     %d\n", stats.SpamCount)
+		fmt.Printf("ham:      %d\n", stats.HamCount)
+		fmt.Printf("log-odds: %.3f\n", stats.LogOdds)
+		if !stats.Counted {
+			fmt.Printf("ignored when scoring: rarer than the model's minimum word frequency of %d\n", classifier.MinWordFreq)
+		}
+		return nil
+	}
+
+	if *chi2 > 0 {
+		fmt.Printf(">> top %d words by chi-squared <<\n", *chi2)
+		for _, feature := range classifier.TopFeatures(*chi2) {
+			label := Ham
+			if feature.Spammy {
+				label = Spam
+			}
+			fmt.Printf("%10.1f %-4s %s\n", feature.Chi2, label, feature.Word)
+		}
+		return nil
+	}
+
+	spammy, hammy := classifier.TopWords(*top)
+	printWordScores("spam", spammy)
+	printWordScores("ham", hammy)
+	return nil
+}
+
+func printWordScores(label string, scores []WordScore) {
+	fmt.Printf(">> top %s words <<\n", label)
+	for _, score := range scores {
+		fmt.Printf("%8.3f %s\n", score.LogOdds, score.Word)
+	}
+}
+
+// runServe serves POST /classify and /classify/batch on --addr, loading the model in the
+// background once the listener is up.
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	modelPath := fs.String("model", "model.gob", "trained model to serve")
+	addr := fs.String("addr", ":8080", "address to listen on")
+	maxBatch := fs.Int("max-batch", DefaultMaxBatch, "most messages a POST /classify/batch request may hold")
+	maxBatchBytes := fs.Int64("max-batch-bytes", DefaultMaxBatchBytes, "most bytes the body of a POST /classify/batch request may hold")
+	workers := fs.Int("workers", 0, "messages of a batch to classify in parallel (0 = GOMAXPROCS)")
+	metrics := fs.Bool("metrics", false, "serve Prometheus metrics at /metrics")
+	var decision decisionOptions
+	decision.register(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *maxBatch < 1 {
+		return fmt.Errorf("--max-batch must be at least 1, got %d", *maxBatch)
+	}
+	if *maxBatchBytes < 1 {
+		return fmt.Errorf("--max-batch-bytes must be at least 1, got %d", *maxBatchBytes)
+	}
+	classifier := NewClassifier()
+	classifier.Workers = *workers
+	if err := decision.apply(classifier); err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf(">> listening on %s <<\n", listener.Addr())
+
+	srv := server{maxBatch: *maxBatch, maxBatchBytes: *maxBatchBytes}
+	if *metrics {
+		srv.metrics = newServerMetrics()
+	}
+	loadErr := make(chan error, 1)
+	go func() {
+		if err := classifier.loadModelFile(*modelPath); err != nil {
+			loadErr <- err
+			return
+		}
+		if err := classifier.checkBinary(); err != nil {
+			loadErr <- fmt.Errorf("serving %q: %w", *modelPath, err)
+			return
+		}
+		srv.classifier.Store(classifier)
+		fmt.Printf(">> loaded %s <<\n", *modelPath)
+	}()
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- http.Serve(listener, srv.handler())
+	}()
 
-		spamScore, hamScore, err := classifyFile(path, hamBow, hamTotal, spamBow, spamTotal)
+	select {
+	case err := <-loadErr:
+		return err
+	case err := <-serveErr:
+		return err
+	}
+}
+
+// runMerge combines separately trained models into one.
+func runMerge(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	out := fs.String("out", "model.gob", "where to save the merged model (.json for JSON, gob otherwise)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s merge --out model.gob MODEL...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if fs.NArg() < 2 {
+		return fmt.Errorf("merge: at least two models are required")
+	}
 
+	merged := NewClassifier()
+	if err := merged.loadModelFile(fs.Arg(0)); err != nil {
+		return err
+	}
+	for _, path := range fs.Args()[1:] {
+		other := NewClassifier()
+		if err := other.loadModelFile(path); err != nil {
+			return err
+		}
+		if err := merged.Merge(other); err != nil {
+			return fmt.Errorf("merging %q: %w", path, err)
+		}
+	}
+	return merged.saveModelFile(*out)
+}
+
+// runRepl classifies messages typed or pasted on stdin until EOF. A blank
+// line ends a message, so multi-line messages can be pasted as they are;
+// the prompts go to stderr so the labels can be piped on.
+func runRepl(args []string) error {
+	fs := flag.NewFlagSet("repl", flag.ExitOnError)
+	modelPath := fs.String("model", "model.gob", "trained model to load")
+	var decision decisionOptions
+	decision.register(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	classifier := NewClassifier()
+	if err := classifier.loadModelFile(*modelPath); err != nil {
+		return err
+	}
+	if err := decision.apply(classifier); err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	var message strings.Builder
+	classify := func() error {
+		defer message.Reset()
+		label, probability, err := classifier.ClassifyText(message.String())
 		if err != nil {
 			return err
 		}
+		fmt.Fprintf(out, "%s %.2f\n", label, probability)
+		return out.Flush()
+	}
 
-		if spamScore > hamScore {
-			spamCount++
+	fmt.Fprintln(os.Stderr, "Enter a message and end it with a blank line; Ctrl-D quits.")
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(nil, 1<<20)
+	for {
+		if message.Len() == 0 {
+			fmt.Fprint(os.Stderr, "> ")
 		} else {
-			hamCount++
+			fmt.Fprint(os.Stderr, ". ")
 		}
-		return nil
-	})
-	return spamCount, hamCount, nil
+		if !scanner.Scan() {
+			break
+		}
+		line := scanner.Text()
+		if strings.TrimSpace(line) != "" {
+			message.WriteString(line)
+			message.WriteByte('\n')
+			continue
+		}
+		if message.Len() == 0 {
+			continue
+		}
+		if err := classify(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(os.Stderr)
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if message.Len() > 0 {
+		return classify()
+	}
+	return nil
 }
 
-func tokenize(message string) []string {
-	tokens := strings.Fields(message)
-	for i := range tokens {
-		tokens[i] = strings.ToUpper(tokens[i])
+// runCompare evaluates two models on the same labeled directory and prints
+// their metrics side by side, followed by the files they label differently.
+func runCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	modelA := fs.String("model-a", "", "first model to compare")
+	modelB := fs.String("model-b", "", "second model to compare")
+	dir := fs.String("test-dir", defaultEvalDir, "labeled directory with ham and spam subdirectories")
+	hamSubdir := fs.String("ham-subdir", DefaultCorpusLayout.HamSubdir, "name of the ham subdirectory")
+	spamSubdir := fs.String("spam-subdir", DefaultCorpusLayout.SpamSubdir, "name of the spam subdirectory")
+	workers := fs.Int("workers", 0, "files to classify in parallel (0 = GOMAXPROCS)")
+	maxDisagreements := fs.Int("max-disagreements", 20, "list at most this many of the files the models label differently (0 = all)")
+	var ext extOptions
+	ext.register(fs)
+	var decision decisionOptions
+	decision.register(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *modelA == "" || *modelB == "" {
+		return fmt.Errorf("compare: --model-a and --model-b are both required")
 	}
-	return tokens
+
+	layout := CorpusLayout{HamSubdir: *hamSubdir, SpamSubdir: *spamSubdir}
+	var evaluations [2]Evaluation
+	var files [2][]EvaluatedFile
+	for i, path := range []string{*modelA, *modelB} {
+		classifier := NewClassifier()
+		if err := classifier.loadModelFile(path); err != nil {
+			return err
+		}
+		classifier.Workers = *workers
+		ext.apply(classifier)
+		if err := decision.apply(classifier); err != nil {
+			return err
+		}
+		e, modelFiles, err := classifier.EvaluateCorpusFiles(*dir, layout)
+		if err != nil {
+			return fmt.Errorf("evaluating %q: %w", path, err)
+		}
+		evaluations[i], files[i] = e, modelFiles
+	}
+
+	a, b := evaluations[0], evaluations[1]
+	fmt.Printf(">> compare on %s <<\n", *dir)
+	fmt.Printf("a: %s\nb: %s\n", *modelA, *modelB)
+	fmt.Printf("%-10s %9s %9s\n", "", "a", "b")
+	fmt.Printf("%-10s %8.2f%% %8.2f%%\n", "accuracy", 100*a.Accuracy(), 100*b.Accuracy())
+	fmt.Printf("%-10s %9.4f %9.4f\n", "precision", a.Precision(), b.Precision())
+	fmt.Printf("%-10s %9.4f %9.4f\n", "recall", a.Recall(), b.Recall())
+	fmt.Printf("%-10s %9.4f %9.4f\n", "f1", a.F1(), b.F1())
+	if a.Unsure > 0 || b.Unsure > 0 {
+		fmt.Printf("%-10s %9d %9d\n", "unsure", a.Unsure, b.Unsure)
+	}
+
+	disagreements := Disagreements(files[0], files[1])
+	fmt.Printf(">> %d disagreements <<\n", len(disagreements))
+	for i, d := range disagreements {
+		if *maxDisagreements > 0 && i == *maxDisagreements {
+			fmt.Printf("... and %d more\n", len(disagreements)-i)
+			break
+		}
+		fmt.Printf("a=%-6s %.4f  b=%-6s %.4f  true=%-4s %s\n", d.A.Label, d.A.Probability, d.B.Label, d.B.Probability, d.TrueLabel, d.Path)
+	}
+	return nil
 }
 
-func totalWordCount(bow Bow) int {
-	count := 0
-	for word := range bow {
-		if bow[word] < MinWordFreq {
-			continue
+// runStats reads the training data like train does and describes it instead
+// of saving a model.
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	var opts trainOptions
+	opts.register(fs)
+	format := fs.String("format", "text", "output format: text or json")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("stats: unknown --format %q (want text or json)", *format)
+	}
+
+	opts.quiet = *format == "json"
+	classifier := NewClassifier()
+	if err := opts.train(classifier); err != nil {
+		return err
+	}
+	stats := classifier.Stats()
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(stats)
+	}
+
+	fmt.Printf(">> stats <<\n")
+	fmt.Printf("%-10s %8s %12s %10s %8s\n", "class", "docs", "tokens", "vocabulary", "counted")
+	for _, class := range stats.Classes {
+		fmt.Printf("%-10s %8d %12d %10d %8d\n", class.Label, class.Docs, class.Tokens, class.Vocabulary, class.Counted)
+	}
+	fmt.Printf("%-10s %8s %12s %10d %8d\n", "all", "", "", stats.Vocabulary, stats.Counted)
+	fmt.Printf("counted: words occurring at least %d times (--min-word-freq)\n", stats.MinWordFreq)
+	for _, class := range stats.Classes {
+		if class.Counted == 0 {
+			fmt.Printf("WARNING: no %s word passes --min-word-freq %d; the model cannot score %s\n", class.Label, stats.MinWordFreq, class.Label)
 		}
-		count += bow[word]
 	}
-	return count
+	return nil
 }
 
-func main() {
-	hamBow := make(Bow)
-	spamBow := make(Bow)
+func runTrain(args []string) error {
+	fs := flag.NewFlagSet("train", flag.ExitOnError)
+	var opts trainOptions
+	opts.register(fs)
+	out := fs.String("out", "model.gob", "where to save the trained model (.json for JSON, gob otherwise)")
+	calibrateDir := fs.String("calibrate-dir", "", "fit probability calibration (Platt scaling) on this held-out labeled directory with ham and spam subdirectories")
+	maxFeatures := fs.Int("max-features", 0, "keep only this many of the most discriminative words, by chi-squared, in the saved model (0 = all)")
+	prune := fs.Bool("prune", false, "drop words rarer than --min-word-freq from the saved model to shrink it (they cannot be trained further)")
+	var classes stringList
+	fs.Var(&classes, "classes", "train these classes, e.g. spam,promotions,personal, instead of ham and spam; every --train-dir then holds a subdirectory named after each")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
 
-	fmt.Println(">> training <<")
-	for i := 1; i <= 5; i++ {
-		err := addDirToBow(fmt.Sprintf("data/enron%v/ham", i), hamBow)
+	classifier := NewClassifier()
+	if labels := splitList(classes); len(labels) > 0 {
+		classifier = NewMultiClassifier(labels...)
+		if len(classifier.Bows) < 2 {
+			return fmt.Errorf("--classes needs at least two classes, got %q", labels)
+		}
+		if !classifier.binary() && (*maxFeatures > 0 || *calibrateDir != "") {
+			return errors.New("--max-features and --calibrate-dir need the classes ham and spam")
+		}
+	}
+	if err := opts.train(classifier); err != nil {
+		return err
+	}
+	if *maxFeatures < 0 {
+		return fmt.Errorf("--max-features must not be negative, got %d", *maxFeatures)
+	}
+	if *maxFeatures > 0 {
+		fmt.Printf(">> dropped %d words beyond the top %d <<\n", classifier.KeepTopFeatures(*maxFeatures), *maxFeatures)
+	} else if *prune {
+		fmt.Printf(">> pruned %d rare words <<\n", classifier.Prune())
+	}
+	if *calibrateDir != "" {
+		files, err := labeledFiles(*calibrateDir, opts.layout(), classifier.Extensions)
 		if err != nil {
-			panic(err)
+			return err
 		}
+		if err := classifier.Calibrate(files); err != nil {
+			return fmt.Errorf("calibrating on %q: %w", *calibrateDir, err)
+		}
+		fmt.Printf(">> calibrated on %d files: A=%.4g B=%.4g <<\n", len(files), classifier.Calibration.A, classifier.Calibration.B)
+	}
+	return classifier.saveModelFile(*out)
+}
 
-		err = addDirToBow(fmt.Sprintf("data/enron%v/spam", i), spamBow)
+// runLearn adds the given messages to a saved model under --label and saves it
+// back, so misclassified messages can be fed back without retraining.
+func runLearn(args []string) error {
+	fs := flag.NewFlagSet("learn", flag.ExitOnError)
+	modelPath := fs.String("model", "model.gob", "trained model to update in place")
+	label := fs.String("label", "", "label of the given messages: ham or spam")
+	unlearn := fs.Bool("unlearn", false, "take messages previously learned or trained as --label back out of the model instead")
+	weight := fs.Int("weight", 1, "count each message this many times, so corrections outweigh bulk training (with --unlearn, the weight it was learned with)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s learn --model model.gob [--unlearn] --label spam FILE...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("learn: at least one file is required")
+	}
+
+	classifier := NewClassifier()
+	if err := classifier.loadModelFile(*modelPath); err != nil {
+		return err
+	}
+
+	for _, path := range fs.Args() {
+		var content []byte
+		var err error
+		if path == "-" {
+			content, err = io.ReadAll(os.Stdin)
+		} else {
+			content, err = os.ReadFile(path)
+		}
+		if err != nil {
+			return err
+		}
+		if *unlearn {
+			err = classifier.RemoveWeightedDocument(string(content), *label, *weight)
+		} else {
+			err = classifier.AddWeightedDocument(string(content), *label, *weight)
+		}
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("learning %q: %w", path, err)
 		}
 	}
+	return classifier.saveModelFile(*modelPath)
+}
+
+func runClassify(args []string) error {
+	fs := flag.NewFlagSet("classify", flag.ExitOnError)
+	modelPath := fs.String("model", "model.gob", "trained model to load")
+	var dirs stringList
+	fs.Var(&dirs, "dir", "directory of emails to classify (repeatable)")
+	var mboxes stringList
+	fs.Var(&mboxes, "mbox", "mbox file whose messages to classify one by one (repeatable)")
+	var tars stringList
+	fs.Var(&tars, "tar", "tar or .tar.gz archive whose files to classify one by one (repeatable)")
+	workers := fs.Int("workers", 0, "files to classify in parallel (0 = GOMAXPROCS)")
+	casingFlag := fs.String("casing", "", "override the model's token case folding (lower, upper or preserve)")
+	explain := fs.Int("explain", 0, "list the N words that contributed most to each FILE's label")
+	format := fs.String("format", "text", "output format: text or json")
+	debug := fs.Bool("debug", false, "log the log and raw probability of every word for every class to stderr, flagging -Inf terms")
+	var ext extOptions
+	ext.register(fs)
+	var decision decisionOptions
+	decision.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s classify --model model.gob [--dir DIR]... [FILE|-]...\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "A FILE of - reads a single message from stdin.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
 
-	hamTotal := totalWordCount(hamBow)
-	spamTotal := totalWordCount(spamBow)
+	if len(dirs) == 0 && len(mboxes) == 0 && len(tars) == 0 && fs.NArg() == 0 {
+		return fmt.Errorf("classify: at least one --dir, --mbox, --tar or file is required")
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("classify: unknown --format %q (want text or json)", *format)
+	}
 
-	fmt.Println(">> classify ham <<")
-	spamCount, hamCount, err := classifyDir("data/enron6/ham", hamBow, hamTotal, spamBow, spamTotal)
-	fmt.Printf("spam: %d \n ham: %d \n", spamCount, hamCount)
+	classifier := NewClassifier()
+	if err := classifier.loadModelFile(*modelPath); err != nil {
+		return err
+	}
+	classifier.Workers = *workers
+	if *debug {
+		classifier.Debug = true
+		classifier.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+	ext.apply(classifier)
+	if err := decision.apply(classifier); err != nil {
+		return err
+	}
+	if *casingFlag != "" {
+		casing, err := parseCasing(*casingFlag)
+		if err != nil {
+			return err
+		}
+		if casing != classifier.Tokenizer.Casing {
+			fmt.Fprintf(os.Stderr, "WARNING: model was trained with %s casing but classifying with %s casing; most words will not match the vocabulary\n", classifier.Tokenizer.Casing, casing)
+		}
+		classifier.Tokenizer.Casing = casing
+	}
+
+	report := &classifyReport{json: *format == "json"}
+	for _, path := range fs.Args() {
+		if err := classifyOne(classifier, report, path, *explain); err != nil {
+			return err
+		}
+	}
+	for _, path := range mboxes {
+		if err := classifyMbox(classifier, report, path); err != nil {
+			return err
+		}
+	}
+	for _, path := range tars {
+		if err := classifyTar(classifier, report, path); err != nil {
+			return err
+		}
+	}
+	for _, dir := range dirs {
+		report.section(dir)
+		results, err := classifier.ClassifyDirResults(dir)
+		if err != nil {
+			return err
+		}
+		report.addDir(results)
+	}
+	return report.finish()
+}
+
+// classifyMbox classifies every message of an mbox file; in text mode that is
+// one line per message followed by the totals.
+func classifyMbox(classifier *Classifier, report *classifyReport, path string) error {
+	f, err := os.Open(path)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	defer f.Close()
 
-	fmt.Println(">> classify spam <<")
-	spamCount, hamCount, err = classifyDir("data/enron6/spam", hamBow, hamTotal, spamBow, spamTotal)
-	fmt.Printf("spam: %d \n ham: %d \n", spamCount, hamCount)
+	report.section(path)
+	var results []FileResult
+	err = eachMboxMessage(f, func(msg []byte) error {
+		msgResult, err := classifier.Classify(bytes.NewReader(msg))
+		if err != nil {
+			return err
+		}
+
+		result := FileResult{Path: fmt.Sprintf("%s#%d", path, len(results)+1), Result: msgResult}
+		report.addMessage(result)
+		results = append(results, result)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	report.counts(results)
+	return nil
+}
+
+func classifyTar(classifier *Classifier, report *classifyReport, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	report.section(path)
+	var results []FileResult
+	err = eachTarMessage(f, func(name string, msg io.Reader) error {
+		msgResult, err := classifier.Classify(msg)
+		if err != nil {
+			return withPath(name, err)
+		}
+
+		result := FileResult{Path: path + ":" + name, Result: msgResult}
+		report.addMessage(result)
+		results = append(results, result)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	report.counts(results)
+	return nil
+}
+
+// classifyOne classifies a single message, reading from stdin when path is
+// "-". With explain > 0 the text output also lists that many of the words
+// that weighed most in the decision.
+func classifyOne(classifier *Classifier, report *classifyReport, path string, explain int) error {
+	var content []byte
+	var err error
+	if path == "-" {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	result, err := classifier.Classify(bytes.NewReader(content))
 	if err != nil {
-		panic(err)
+		return err
+	}
+	report.addFile(FileResult{Path: path, Result: result})
+
+	if explain > 0 && !report.json {
+		contributions, err := classifier.ExplainReader(bytes.NewReader(content))
+		if err != nil {
+			return err
+		}
+		for _, contribution := range contributions[:min(explain, len(contributions))] {
+			fmt.Printf("  %+8.3f %s\n", contribution.LogOdds, contribution.Word)
+		}
+	}
+	return nil
+}
+
+// errUsage is returned by run for a command line it cannot make sense of,
+// after the usage has been printed.
+var errUsage = errors.New("invalid usage")
+
+// run executes the subcommand named by args, os.Args without the program
+// name.
+func run(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runAll(args)
+	}
+
+	switch args[0] {
+	case "train":
+		return runTrain(args[1:])
+	case "classify":
+		return runClassify(args[1:])
+	case "learn":
+		return runLearn(args[1:])
+	case "evaluate":
+		return runEvaluate(args[1:])
+	case "crossval":
+		return runCrossValidate(args[1:])
+	case "inspect":
+		return runInspect(args[1:])
+	case "serve":
+		return runServe(args[1:])
+	case "merge":
+		return runMerge(args[1:])
+	case "stats":
+		return runStats(args[1:])
+	case "compare":
+		return runCompare(args[1:])
+	case "repl":
+		return runRepl(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown subcommand %q\n\n", args[0])
+		usage()
+		return errUsage
+	}
+}
+
+func main() {
+	err := run(os.Args[1:])
+	switch {
+	case errors.Is(err, errUsage):
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "%s: %v\n", filepath.Base(os.Args[0]), err)
+		os.Exit(1)
 	}
 }
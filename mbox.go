@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+)
+
+// eachMboxMessage splits an mbox stream on its "From " separator lines and
+// calls fn with every message body. Lines quoted as ">From " (or ">>From ",
+// mboxrd style) inside a body get one level of quoting removed.
+func eachMboxMessage(r io.Reader, fn func(msg []byte) error) error {
+	reader := bufio.NewReader(r)
+	var msg bytes.Buffer
+	started := false
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if bytes.HasPrefix(line, []byte("From ")) {
+				if started {
+					if err := fn(msg.Bytes()); err != nil {
+						return err
+					}
+				}
+				msg.Reset()
+				started = true
+			} else if started {
+				if isQuotedFrom(line) {
+					line = line[1:]
+				}
+				msg.Write(line)
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if started {
+		return fn(msg.Bytes())
+	}
+	return nil
+}
+
+func isQuotedFrom(line []byte) bool {
+	unquoted := bytes.TrimLeft(line, ">")
+	return len(unquoted) < len(line) && bytes.HasPrefix(unquoted, []byte("From "))
+}
+
+// TrainMbox adds every message of the mbox file at path to the Bow of label.
+func (c *Classifier) TrainMbox(path string, label string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bow, err := c.bowFor(label)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	messages := 0
+	err = eachMboxMessage(f, func(msg []byte) error {
+		added, err := c.addTrainingReader(bytes.NewReader(msg), bow, c.docFreq())
+		if err != nil || !added {
+			return err
+		}
+		c.countDocs(label, 1)
+		messages++
+		return nil
+	})
+	if err != nil {
+		// Keep the totals in step with the messages added before the
+		// failing one.
+		c.updateTotals()
+		return err
+	}
+
+	c.updateTotals()
+	c.logger().Info("trained", "mbox", path, "label", label, "messages", messages)
+	return nil
+}
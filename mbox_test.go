@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestTrainMboxKeepsTotalsOnError(t *testing.T) {
+	// The second message looks gzip-compressed but is not, so reading it
+	// fails after the first has been trained.
+	path := writeFile(t, "spam.mbox", "From a@example.com Mon Jan  1 00:00:00 2024\n"+
+		"free money now\n"+
+		"\n"+
+		"From b@example.com Mon Jan  1 00:00:00 2024\n"+
+		"\x1f\x8bnot gzip at all\n")
+	c := NewClassifier()
+	c.MinWordFreq = 1
+	if err := c.TrainMbox(path, Spam); err == nil {
+		t.Fatal("TrainMbox read a corrupt gzip message")
+	}
+	if c.Docs[Spam] != 1 {
+		t.Errorf("trained %d messages before the bad one, want 1", c.Docs[Spam])
+	}
+	checkTotals(t, c)
+}
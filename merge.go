@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Merge adds the counts of other, a model trained separately (say, on another
+// language or by another worker), to c, as if c had also been trained on
+// other's messages. Both must count words the same way, so their
+// classes, MinWordFreq, event model, hashing and tokenizer casing, n-gram
+// length and stemming have to match.
+func (c *Classifier) Merge(other *Classifier) error {
+	if c == other {
+		return errors.New("cannot merge a classifier into itself")
+	}
+	// Copy other before locking c, rather than holding both locks, so that
+	// a.Merge(b) and b.Merge(a) at the same time cannot deadlock.
+	other = other.snapshot()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, setting := range []struct {
+		name        string
+		mine, their any
+	}{
+		{"classes", strings.Join(c.labels(), ","), strings.Join(other.labels(), ",")},
+		{"min word frequency", c.MinWordFreq, other.MinWordFreq},
+		{"event model", c.EventModel, other.EventModel},
+		{"hash buckets", c.HashBuckets, other.HashBuckets},
+		{"casing", c.Tokenizer.Casing, other.Tokenizer.Casing},
+		{"ngram", c.Tokenizer.NGram, other.Tokenizer.NGram},
+		{"character ngram", c.Tokenizer.CharNGram, other.Tokenizer.CharNGram},
+		{"stemming", c.Tokenizer.Stem, other.Tokenizer.Stem},
+	} {
+		if setting.mine != setting.their {
+			return fmt.Errorf("cannot merge models with different %s (%v and %v)", setting.name, setting.mine, setting.their)
+		}
+	}
+
+	if c.HashBuckets > 0 {
+		for label := range c.Bows {
+			if from := other.buckets[label]; from != nil {
+				c.bucketsFor(label).merge(from)
+			}
+			c.Docs[label] += other.Docs[label]
+		}
+		if other.bucketDocFreq != nil {
+			c.bucketDocFreq.merge(other.bucketDocFreq)
+		}
+		c.updateTotals()
+		return nil
+	}
+
+	bows := []struct{ into, from Bow }{{c.DocFreq, other.DocFreq}}
+	for label, bow := range c.Bows {
+		bows = append(bows, struct{ into, from Bow }{bow, other.Bows[label]})
+		c.Docs[label] += other.Docs[label]
+	}
+	for _, bows := range bows {
+		for word, count := range bows.from {
+			bows.into[word] += count
+		}
+	}
+	c.updateTotals()
+	return nil
+}
+
+// snapshot returns a copy of c's settings and counts, taken under its read
+// lock.
+func (c *Classifier) snapshot() *Classifier {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	copied := c.emptyCopy()
+	for label, bow := range c.Bows {
+		maps.Copy(copied.Bows[label], bow)
+	}
+	maps.Copy(copied.DocFreq, c.DocFreq)
+	maps.Copy(copied.Docs, c.Docs)
+	if c.buckets != nil {
+		copied.buckets = make(map[string]buckets, len(c.buckets))
+		for label, b := range c.buckets {
+			copied.buckets[label] = slices.Clone(b)
+		}
+		copied.bucketDocFreq = slices.Clone(c.bucketDocFreq)
+	}
+	return copied
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMergeBothWaysConcurrently(t *testing.T) {
+	// Big enough that a Merge takes a while and the two overlap.
+	a, b := trainedClassifier(t), trainedClassifier(t)
+	for i := range 30000 {
+		a.Bows[Spam]["word"+strconv.Itoa(i)]++
+		b.Bows[Ham]["word"+strconv.Itoa(i)]++
+	}
+
+	done := make(chan struct{})
+	go func() {
+		var wg sync.WaitGroup
+		for range 5 {
+			wg.Add(2)
+			go func() { defer wg.Done(); a.Merge(b) }()
+			go func() { defer wg.Done(); b.Merge(a) }()
+		}
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(20 * time.Second):
+		t.Fatal("a.Merge(b) and b.Merge(a) deadlocked")
+	}
+}
+
+func TestMergeHalvesEqualsWhole(t *testing.T) {
+	halves := [2]*Classifier{NewClassifier(), NewClassifier()}
+	for i, doc := range trainingDocs {
+		half := halves[i%2]
+		half.MinWordFreq = 1
+		if err := half.AddDocument(doc.text, doc.label); err != nil {
+			t.Fatal(err)
+		}
+	}
+	merged := halves[0]
+	if err := merged.Merge(halves[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	whole := trainedClassifier(t)
+	sameCounts(t, merged, whole)
+	if merged.VocabSize != whole.VocabSize {
+		t.Errorf("merged vocabulary has %d words, want %d", merged.VocabSize, whole.VocabSize)
+	}
+}
+
+func TestMergeRejectsDifferentSettings(t *testing.T) {
+	a, b := trainedClassifier(t), trainedClassifier(t)
+	b.Tokenizer.NGram = 2
+	if err := a.Merge(b); err == nil || !strings.Contains(err.Error(), "ngram") {
+		t.Errorf("Merge = %v, want an error about the ngram setting", err)
+	}
+	if err := a.Merge(a); err == nil {
+		t.Error("Merge merged a classifier into itself")
+	}
+}
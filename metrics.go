@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the scoring latency
+// histogram.
+var latencyBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1}
+
+// serverMetrics counts the server's classifications and serves them at
+// /metrics in the Prometheus text format, written out by hand so serving
+// metrics does not need the Prometheus client library.
+type serverMetrics struct {
+	mu sync.Mutex
+
+	// classifications counts the messages labeled so far, by label; their
+	// sum is the total.
+	classifications map[string]uint64
+
+	// buckets[i] counts the scorings that took at most latencyBuckets[i];
+	// they are made cumulative when written.
+	buckets      []uint64
+	latencyCount uint64
+	latencySum   float64
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		classifications: map[string]uint64{Ham: 0, Spam: 0, Unsure: 0},
+		buckets:         make([]uint64, len(latencyBuckets)),
+	}
+}
+
+// observe records one message labeled label in elapsed. It does nothing on
+// a nil *serverMetrics, so the handlers need not check whether metrics are on.
+func (m *serverMetrics) observe(label string, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	seconds := elapsed.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.classifications[label]++
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			m.buckets[i]++
+			break
+		}
+	}
+	m.latencyCount++
+	m.latencySum += seconds
+}
+
+func (m *serverMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP spamfilter_classifications_total Messages classified, by label.")
+	fmt.Fprintln(w, "# TYPE spamfilter_classifications_total counter")
+	for _, label := range []string{Ham, Spam, Unsure} {
+		fmt.Fprintf(w, "spamfilter_classifications_total{label=%q} %d\n", label, m.classifications[label])
+	}
+
+	fmt.Fprintln(w, "# HELP spamfilter_classify_duration_seconds Time taken to tokenize and score one message.")
+	fmt.Fprintln(w, "# TYPE spamfilter_classify_duration_seconds histogram")
+	var cumulative uint64
+	for i, bound := range latencyBuckets {
+		cumulative += m.buckets[i]
+		fmt.Fprintf(w, "spamfilter_classify_duration_seconds_bucket{le=\"%g\"} %d\n", bound, cumulative)
+	}
+	fmt.Fprintf(w, "spamfilter_classify_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.latencyCount)
+	fmt.Fprintf(w, "spamfilter_classify_duration_seconds_sum %g\n", m.latencySum)
+	fmt.Fprintf(w, "spamfilter_classify_duration_seconds_count %d\n", m.latencyCount)
+}
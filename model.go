@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// modelVersion is the schema version written into saved models. Bump it when
+// a change would make older code misread a new model (or the other way
+// round); models without a version predate versioning and are still read.
+//
+// Version 2 added classes other than ham and spam, saved in Bows and Docs.
+// Ham and spam models are still written as version 1 so that older builds
+// keep reading them.
+//
+// Version 3 moved the counts of hashed models (HashBuckets) out of the Bows,
+// where they were kept under bucket names, into Buckets and BucketDocFreq.
+// Only hashed models are written as version 3.
+const modelVersion = 3
+
+// binaryModelVersion is the version of models with only ham and spam.
+const binaryModelVersion = 1
+
+// classesModelVersion is the version of models with other classes.
+const classesModelVersion = 2
+
+// model is the on-disk form of a trained Classifier.
+type model struct {
+	Version         int                `json:"version"`
+	HamBow          Bow                `json:"ham_bow"`
+	SpamBow         Bow                `json:"spam_bow"`
+	HamTotal        int                `json:"ham_total,omitempty"`
+	SpamTotal       int                `json:"spam_total,omitempty"`
+	Bows            map[string]Bow     `json:"bows,omitempty"`
+	Docs            map[string]int     `json:"docs,omitempty"`
+	Alpha           float64            `json:"alpha"`
+	MinWordFreq     int                `json:"min_word_freq"`
+	ParseEmail      bool               `json:"parse_email"`
+	SubjectWeight   float64            `json:"subject_weight"`
+	StripHTML       bool               `json:"strip_html"`
+	StripQuotes     bool               `json:"strip_quotes,omitempty"`
+	Casing          Casing             `json:"casing"`
+	NGram           int                `json:"ngram"`
+	StopWords       map[string]bool    `json:"stop_words,omitempty"`
+	Stem            bool               `json:"stem"`
+	MinLength       int                `json:"min_token_length"`
+	MaxLength       int                `json:"max_token_length"`
+	Normalize       bool               `json:"normalize"`
+	StripMarks      bool               `json:"strip_marks"`
+	Numbers         bool               `json:"numbers"`
+	Links           bool               `json:"links"`
+	CharNGram       int                `json:"char_ngram,omitempty"`
+	CustomTokenizer bool               `json:"custom_tokenizer,omitempty"`
+	CustomFeatures  int                `json:"custom_features,omitempty"`
+	HashBuckets     int                `json:"hash_buckets,omitempty"`
+	Buckets         map[string]buckets `json:"buckets,omitempty"`
+	BucketDocFreq   buckets            `json:"bucket_doc_freq,omitempty"`
+	TFIDF           bool               `json:"tfidf"`
+	DocFreq         Bow                `json:"doc_freq"`
+	HamDocs         int                `json:"ham_docs,omitempty"`
+	SpamDocs        int                `json:"spam_docs,omitempty"`
+	EventModel      EventModel         `json:"event_model"`
+	Prior           Prior              `json:"prior"`
+	SpamWeight      float64            `json:"spam_weight"`
+	HamWeight       float64            `json:"ham_weight"`
+	Calibration     *Calibration       `json:"calibration,omitempty"`
+}
+
+// toModel shares the Bows of c, so the caller must hold c.mu until it is done
+// with the result.
+func (c *Classifier) toModel() model {
+	m := model{
+		Alpha:           c.Alpha,
+		MinWordFreq:     c.MinWordFreq,
+		ParseEmail:      c.ParseEmail,
+		SubjectWeight:   c.SubjectWeight,
+		StripHTML:       c.StripHTML,
+		StripQuotes:     c.StripQuotes,
+		Casing:          c.Tokenizer.Casing,
+		NGram:           c.Tokenizer.NGram,
+		StopWords:       c.Tokenizer.StopWords,
+		Stem:            c.Tokenizer.Stem,
+		MinLength:       c.Tokenizer.MinLength,
+		MaxLength:       c.Tokenizer.MaxLength,
+		Normalize:       c.Tokenizer.Normalize,
+		StripMarks:      c.Tokenizer.StripMarks,
+		Numbers:         c.Tokenizer.Numbers,
+		Links:           c.Tokenizer.Links,
+		CharNGram:       c.Tokenizer.CharNGram,
+		CustomTokenizer: c.Tokenize != nil,
+		CustomFeatures:  len(c.Features),
+		HashBuckets:     c.HashBuckets,
+		TFIDF:           c.TFIDF,
+		DocFreq:         c.DocFreq,
+		EventModel:      c.EventModel,
+		Prior:           c.Prior,
+		SpamWeight:      c.SpamWeight,
+		HamWeight:       c.HamWeight,
+		Calibration:     c.Calibration,
+	}
+	switch {
+	case c.HashBuckets > 0:
+		m.Version = modelVersion
+		m.Buckets = make(map[string]buckets, len(c.Bows))
+		for label := range c.Bows {
+			m.Buckets[label] = c.buckets[label]
+		}
+		m.BucketDocFreq = c.bucketDocFreq
+		m.Docs = c.Docs
+	case c.binary():
+		m.Version = binaryModelVersion
+		m.HamBow, m.SpamBow = c.Bows[Ham], c.Bows[Spam]
+		m.HamTotal, m.SpamTotal = c.Totals[Ham], c.Totals[Spam]
+		m.HamDocs, m.SpamDocs = c.Docs[Ham], c.Docs[Spam]
+	default:
+		m.Version = classesModelVersion
+		m.Bows = c.Bows
+		m.Docs = c.Docs
+	}
+	return m
+}
+
+func (c *Classifier) fromModel(m model) error {
+	if m.Version < 0 || m.Version > modelVersion {
+		return fmt.Errorf("model version %d is not supported (this build reads versions up to %d)", m.Version, modelVersion)
+	}
+	bows, docs := m.Bows, m.Docs
+	if m.Buckets != nil {
+		bows = make(map[string]Bow, len(m.Buckets))
+		for label := range m.Buckets {
+			bows[label] = make(Bow)
+		}
+	}
+	if bows == nil {
+		if m.HamBow == nil || m.SpamBow == nil {
+			return errors.New("model has no vocabulary")
+		}
+		bows = map[string]Bow{Ham: m.HamBow, Spam: m.SpamBow}
+		docs = map[string]int{Ham: m.HamDocs, Spam: m.SpamDocs}
+	}
+	if docs == nil {
+		docs = make(map[string]int)
+	}
+	var counts map[string]buckets
+	var docFreq buckets
+	if m.HashBuckets > 0 {
+		var err error
+		if counts, docFreq, err = m.bucketCounts(bows); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.loads++
+	c.Bows = bows
+	c.Docs = docs
+	c.Totals = make(map[string]int)
+	c.Alpha = m.Alpha
+	c.MinWordFreq = m.MinWordFreq
+	c.ParseEmail = m.ParseEmail
+	c.SubjectWeight = m.SubjectWeight
+	if c.SubjectWeight == 0 {
+		// Models saved before subjects could be weighted.
+		c.SubjectWeight = DefaultSubjectWeight
+	}
+	c.StripHTML = m.StripHTML
+	c.StripQuotes = m.StripQuotes
+	c.Tokenizer.Casing = m.Casing
+	if c.Tokenizer.Casing == "" {
+		// Models saved before casing was configurable were always upper-cased.
+		c.Tokenizer.Casing = CaseUpper
+	}
+	c.Tokenizer.NGram = m.NGram
+	c.Tokenizer.StopWords = m.StopWords
+	c.Tokenizer.Stem = m.Stem
+	c.Tokenizer.MinLength = m.MinLength
+	c.Tokenizer.MaxLength = m.MaxLength
+	c.Tokenizer.Normalize = m.Normalize
+	c.Tokenizer.StripMarks = m.StripMarks
+	c.Tokenizer.Numbers = m.Numbers
+	c.Tokenizer.Links = m.Links
+	c.Tokenizer.CharNGram = m.CharNGram
+	if m.CustomTokenizer && c.Tokenize == nil {
+		c.logger().Warn("model was trained with a custom tokenizer; classifying with the built-in one instead")
+	}
+	if m.CustomFeatures > len(c.Features) {
+		c.logger().Warn("model was trained with more feature extractors than are set", "trained", m.CustomFeatures, "set", len(c.Features))
+	}
+	c.HashBuckets = m.HashBuckets
+	c.buckets, c.bucketDocFreq = counts, docFreq
+	c.TFIDF = m.TFIDF
+	c.DocFreq = m.DocFreq
+	if c.DocFreq == nil || c.HashBuckets > 0 {
+		// Models saved before document frequencies were tracked, or
+		// hashed ones, which count them in bucketDocFreq.
+		c.DocFreq = make(Bow)
+	}
+	c.EventModel = m.EventModel
+	if c.EventModel == "" {
+		c.EventModel = Multinomial
+	}
+	c.Prior = m.Prior
+	if c.Prior == "" {
+		// Models saved before priors were configurable.
+		c.Prior = PriorEmpirical
+	}
+	c.Calibration = m.Calibration
+	c.SpamWeight, c.HamWeight = m.SpamWeight, m.HamWeight
+	if c.SpamWeight == 0 || c.HamWeight == 0 {
+		c.SpamWeight, c.HamWeight = 1, 1
+	}
+	c.updateTotals()
+	return nil
+}
+
+func (c *Classifier) SaveJSON(path string) error {
+	c.mu.RLock()
+	content, err := json.Marshal(c.toModel())
+	c.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+func (c *Classifier) LoadJSON(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if len(content) == 0 {
+		return fmt.Errorf("model file %q is empty", path)
+	}
+
+	var m model
+	if err := json.Unmarshal(content, &m); err != nil {
+		return fmt.Errorf("model file %q: %w", path, err)
+	}
+	if err := c.fromModel(m); err != nil {
+		return fmt.Errorf("model file %q: %w", path, err)
+	}
+	return nil
+}
+
+// SaveGob writes the model in gob form, which is much smaller and faster to
+// load than JSON. w can be a file, a gzip.Writer, a network stream, etc.
+func (c *Classifier) SaveGob(w io.Writer) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return gob.NewEncoder(w).Encode(c.toModel())
+}
+
+func (c *Classifier) LoadGob(r io.Reader) error {
+	var m model
+	if err := gob.NewDecoder(r).Decode(&m); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errors.New("model stream is empty")
+		}
+		return err
+	}
+	return c.fromModel(m)
+}
+
+// saveModelFile writes the model to path, picking JSON for a .json extension
+// and gob for anything else.
+func (c *Classifier) saveModelFile(path string) error {
+	if filepath.Ext(path) == ".json" {
+		return c.SaveJSON(path)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := c.SaveGob(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (c *Classifier) loadModelFile(path string) error {
+	if filepath.Ext(path) == ".json" {
+		return c.LoadJSON(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := c.LoadGob(f); err != nil {
+		return fmt.Errorf("model file %q: %w", path, err)
+	}
+	return nil
+}
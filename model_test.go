@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sameScores fails t unless a and b score message identically.
+func sameScores(t *testing.T, a *Classifier, b *Classifier, message string) {
+	t.Helper()
+	spamA, hamA, err := a.ClassifyReader(strings.NewReader(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spamB, hamB, err := b.ClassifyReader(strings.NewReader(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spamA != spamB || hamA != hamB {
+		t.Errorf("scores of %q changed from %v, %v to %v, %v", message, spamA, hamA, spamB, hamB)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	c := trainedClassifier(t)
+	path := filepath.Join(t.TempDir(), "model.json")
+	if err := c.SaveJSON(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewClassifier()
+	if err := loaded.LoadJSON(path); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.MinWordFreq != c.MinWordFreq {
+		t.Errorf("MinWordFreq is %d after loading, want %d", loaded.MinWordFreq, c.MinWordFreq)
+	}
+	sameScores(t, c, loaded, "free money for the meeting tomorrow")
+}
+
+func TestLoadJSONErrors(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"empty", "", "is empty"},
+		{"no vocabulary", `{"version": 1, "min_word_freq": 5}`, "no vocabulary"},
+		{"not json", "spam", "invalid character"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeFile(t, "model.json", test.content)
+			err := NewClassifier().LoadJSON(path)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("LoadJSON = %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestGobRoundTrip(t *testing.T) {
+	c := trainedClassifier(t)
+	var saved bytes.Buffer
+	if err := c.SaveGob(&saved); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewClassifier()
+	if err := loaded.LoadGob(&saved); err != nil {
+		t.Fatal(err)
+	}
+	sameScores(t, c, loaded, "free money for the meeting tomorrow")
+	if err := NewClassifier().LoadGob(&saved); err == nil {
+		t.Error("LoadGob read a model from an exhausted stream")
+	}
+}
+
+func TestLoadRejectsNewerVersion(t *testing.T) {
+	m := trainedClassifier(t).toModel()
+	m.Version = modelVersion + 1
+
+	content, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeFile(t, "model.json", string(content))
+	if err := NewClassifier().LoadJSON(path); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("LoadJSON = %v, want the version to be rejected", err)
+	}
+
+	var saved bytes.Buffer
+	if err := gob.NewEncoder(&saved).Encode(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewClassifier().LoadGob(&saved); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("LoadGob = %v, want the version to be rejected", err)
+	}
+}
+
+func TestModelKeepsTrainingParameters(t *testing.T) {
+	c := NewClassifier()
+	c.MinWordFreq = 1
+	c.Tokenizer.NGram = 2
+	c.Tokenizer.Casing = CasePreserve
+	for _, doc := range trainingDocs {
+		if err := c.AddDocument(doc.text, doc.label); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var saved bytes.Buffer
+	if err := c.SaveGob(&saved); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewClassifier()
+	if err := loaded.LoadGob(&saved); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.MinWordFreq != 1 || loaded.Tokenizer.NGram != 2 || loaded.Tokenizer.Casing != CasePreserve {
+		t.Errorf("loaded MinWordFreq %d, NGram %d, Casing %q; want 1, 2, %q",
+			loaded.MinWordFreq, loaded.Tokenizer.NGram, loaded.Tokenizer.Casing, CasePreserve)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"unicode"
+)
+
+// A compact stand-in for Unicode NFKC. Compatibility characters that spammers
+// use to dodge filters (fullwidth "ｆｒｅｅ", mathematical "𝐟𝐫𝐞𝐞", ligatures,
+// no-break spaces, ...) are replaced by their plain forms, invisible
+// characters slipped into words ("fr\u200bee") are dropped, and a Latin
+// letter followed by a combining mark is composed into the precomposed
+// letter. NFKC itself keeps the invisible ones, but they only ever serve to
+// split a word for the filter and not for the reader. With
+// stripMarks, accents are removed instead so "ḟree" becomes "free".
+//
+// Only the blocks in normalize_tables.go are covered; everything else passes
+// through unchanged.
+
+var canonicalDecompositions = func() map[rune][2]rune {
+	decompositions := make(map[rune][2]rune, len(canonicalPairs))
+	for pair, composed := range canonicalPairs {
+		decompositions[composed] = pair
+	}
+	return decompositions
+}()
+
+func normalizeText(s string, stripMarks bool) string {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return s
+	}
+
+	out := make([]rune, 0, len(s))
+	for _, r := range s {
+		for _, m := range compatibilityForm(r) {
+			if stripMarks {
+				out = appendWithoutMarks(out, m)
+				continue
+			}
+			if n := len(out); n > 0 {
+				if composed, ok := canonicalPairs[[2]rune{out[n-1], m}]; ok {
+					out[n-1] = composed
+					continue
+				}
+			}
+			out = append(out, m)
+		}
+	}
+	return string(out)
+}
+
+// compatibilityForm returns the NFKC replacement of a single rune.
+func compatibilityForm(r rune) string {
+	switch {
+	case r >= 0xFF01 && r <= 0xFF5E:
+		// Fullwidth ASCII.
+		return string(r - 0xFEE0)
+	case r == 0x3000:
+		// Ideographic space.
+		return " "
+	case r == 0x00AD, r >= 0x200B && r <= 0x200D, r == 0x2060, r == 0xFEFF:
+		// Soft hyphen, zero-width space, non-joiner and joiner, word joiner
+		// and zero-width no-break space.
+		return ""
+	case r >= 0x1D400 && r <= 0x1D6A3:
+		// Mathematical alphanumerics: 13 styles of A-Z followed by a-z.
+		i := (r - 0x1D400) % 52
+		if i < 26 {
+			return string('A' + i)
+		}
+		return string('a' + i - 26)
+	case r >= 0x1D7CE && r <= 0x1D7FF:
+		// Mathematical digits: 5 styles of 0-9.
+		return string('0' + (r-0x1D7CE)%10)
+	}
+	if replacement, ok := compatibilityRunes[r]; ok {
+		return replacement
+	}
+	return string(r)
+}
+
+// appendWithoutMarks appends the base letter of r, dropping every combining
+// mark in its canonical decomposition.
+func appendWithoutMarks(out []rune, r rune) []rune {
+	if pair, ok := canonicalDecompositions[r]; ok {
+		out = appendWithoutMarks(out, pair[0])
+		return appendWithoutMarks(out, pair[1])
+	}
+	if unicode.Is(unicode.Mn, r) {
+		return out
+	}
+	return append(out, r)
+}
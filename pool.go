@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// parallelFor calls fn(worker, i) for every i in [0, n) on at most workers
+// goroutines; worker identifies the goroutine so callers can keep per-worker
+// state without locking. It stops handing out work after the first error, or
+// once ctx is done, and returns that error or ctx.Err().
+func parallelFor(ctx context.Context, n int, workers int, fn func(worker int, i int) error) error {
+	indices := make(chan int)
+	stop := make(chan struct{})
+	var firstErr error
+	var once sync.Once
+
+	var wg sync.WaitGroup
+	for worker := range min(workers, n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				if err := fn(worker, i); err != nil {
+					once.Do(func() {
+						firstErr = err
+						close(stop)
+					})
+					return
+				}
+			}
+		}()
+	}
+
+	cancelled := false
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case indices <- i:
+		case <-stop:
+			break feed
+		case <-ctx.Done():
+			cancelled = true
+			break feed
+		}
+	}
+	close(indices)
+	wg.Wait()
+	if firstErr == nil && cancelled {
+		return ctx.Err()
+	}
+	return firstErr
+}
+
+// ExtFilter selects files by extension, compared case-insensitively and
+// with or without the leading dot. An empty Include keeps every extension
+// that Exclude does not list.
+type ExtFilter struct {
+	Include []string
+	Exclude []string
+}
+
+func (f ExtFilter) Match(path string) bool {
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	if hasExt(f.Exclude, ext) {
+		return false
+	}
+	return len(f.Include) == 0 || hasExt(f.Include, ext)
+}
+
+func hasExt(exts []string, ext string) bool {
+	for _, e := range exts {
+		if strings.EqualFold(strings.TrimPrefix(e, "."), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// listFiles returns the paths of the regular files under dir that filter
+// matches, in lexical order. It gives up with ctx.Err() once ctx is done.
+func listFiles(ctx context.Context, dir string, filter ExtFilter) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || !filter.Match(path) {
+			return nil
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	// WalkDir's order is lexical per directory, which puts "a/b" before
+	// "a-c"; sorting makes the results follow plain path order.
+	sort.Strings(paths)
+	return paths, err
+}
+
+// withPath prefixes err with path unless it already names it, as the
+// *fs.PathError of a failed open or read does.
+func withPath(path string, err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return err
+	}
+	return fmt.Errorf("%s: %w", path, err)
+}
+
+// checkDir reports a missing or non-directory dir up front with a message
+// naming it, e.g. `training dir "data/enron1/ham": no such directory`.
+func checkDir(kind string, dir string) error {
+	info, err := os.Stat(dir)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("%s %q: no such directory", kind, dir)
+	case err != nil:
+		return fmt.Errorf("%s %q: %w", kind, dir, err)
+	case !info.IsDir():
+		return fmt.Errorf("%s %q: not a directory", kind, dir)
+	}
+	return nil
+}
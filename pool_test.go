@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestExtensionFilter(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.EML", "d.jpg", "e.pdf", "f"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("free money now"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeGzip(t, dir, "c.txt.gz", "free money now")
+
+	for _, test := range []struct {
+		name   string
+		filter ExtFilter
+		want   []string
+	}{
+		{"all", ExtFilter{}, []string{"a.txt", "b.EML", "c.txt.gz", "d.jpg", "e.pdf", "f"}},
+		{"include", ExtFilter{Include: []string{"txt", ".eml", "gz"}}, []string{"a.txt", "b.EML", "c.txt.gz"}},
+		{"exclude", ExtFilter{Exclude: []string{".jpg", "PDF"}}, []string{"a.txt", "b.EML", "c.txt.gz", "f"}},
+		{"both", ExtFilter{Include: []string{"txt", "eml", "gz"}, Exclude: []string{"gz"}}, []string{"a.txt", "b.EML"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := trainedClassifier(t)
+			c.Extensions = test.filter
+			results, err := c.ClassifyDirResults(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, result := range results {
+				got = append(got, filepath.Base(result.Path))
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("classified %q, want %q", got, test.want)
+			}
+
+			trained := NewClassifier()
+			trained.Extensions = test.filter
+			if err := trained.Train(dir, Spam); err != nil {
+				t.Fatal(err)
+			}
+			if trained.Docs[Spam] != len(test.want) {
+				t.Errorf("trained %d files, want %d", trained.Docs[Spam], len(test.want))
+			}
+		})
+	}
+}
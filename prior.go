@@ -0,0 +1,26 @@
+package main
+
+import "fmt"
+
+// Prior decides where the class priors P(spam) and P(ham) come from.
+//
+// Empirical priors are the share of training messages of each class, which
+// is what naive Bayes assumes. On a skewed corpus, say ten spam messages for
+// every ham, that prior alone adds log(10) to every spam score, so short or
+// unremarkable messages tip to the majority class. Uniform ignores how many
+// messages each class had and lets the words decide.
+type Prior string
+
+const (
+	PriorEmpirical Prior = "empirical"
+	PriorUniform   Prior = "uniform"
+)
+
+func parsePrior(s string) (Prior, error) {
+	switch prior := Prior(s); prior {
+	case PriorEmpirical, PriorUniform:
+		return prior, nil
+	default:
+		return "", fmt.Errorf("unknown prior %q (want empirical or uniform)", s)
+	}
+}
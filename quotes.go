@@ -0,0 +1,28 @@
+package main
+
+import "bytes"
+
+// stripQuotes drops the lines of content quoted from an earlier message,
+// those starting with '>' (after any indentation), and everything from a
+// "-- " signature delimiter line on, so forwarded and replied-to mail is
+// judged by what its sender wrote.
+func stripQuotes(content []byte) []byte {
+	var out []byte
+	for len(content) > 0 {
+		line := content
+		if i := bytes.IndexByte(content, '\n'); i >= 0 {
+			line, content = content[:i+1], content[i+1:]
+		} else {
+			content = nil
+		}
+		text := bytes.TrimRight(line, "\r\n")
+		if string(text) == "-- " {
+			break
+		}
+		if bytes.HasPrefix(bytes.TrimLeft(text, " \t"), []byte(">")) {
+			continue
+		}
+		out = append(out, line...)
+	}
+	return out
+}
@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+const replyMessage = "Sounds good, see you at the meeting.\r\n" +
+	"\r\n" +
+	"On Monday, Bob wrote:\r\n" +
+	"> Can we move the meeting?\r\n" +
+	">> FREE MONEY click here\r\n" +
+	"  > indented quote\r\n" +
+	"\r\n" +
+	"Thanks, a -- b is not a signature\r\n" +
+	"--\r\n" +
+	"still the body\r\n" +
+	"-- \r\n" +
+	"Alice\r\n" +
+	"Sent from my phone\r\n"
+
+func TestStripQuotes(t *testing.T) {
+	want := "Sounds good, see you at the meeting.\r\n" +
+		"\r\n" +
+		"On Monday, Bob wrote:\r\n" +
+		"\r\n" +
+		"Thanks, a -- b is not a signature\r\n" +
+		"--\r\n" +
+		"still the body\r\n"
+	if got := string(stripQuotes([]byte(replyMessage))); got != want {
+		t.Errorf("stripQuotes left %q, want %q", got, want)
+	}
+	if got := string(stripQuotes([]byte("no newline at the end"))); got != "no newline at the end" {
+		t.Errorf("stripQuotes left %q of a message without a final newline", got)
+	}
+}
+
+func TestClassifierStripQuotes(t *testing.T) {
+	c := NewClassifier()
+	c.MinWordFreq = 1
+	c.StripQuotes = true
+	if err := c.AddDocument(replyMessage, Ham); err != nil {
+		t.Fatal(err)
+	}
+	for word, want := range map[string]int{"meeting": 1, "body": 1, "money": 0, "indented": 0, "alice": 0, "phone": 0} {
+		if got := c.Bows[Ham][word]; got != want {
+			t.Errorf("%s counted %d times, want %d", word, got, want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"unicode/utf8"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// decompress returns a reader over the uncompressed bytes of r. gzip input is
+// recognized by its magic bytes rather than a .gz extension, so it works the
+// same for files, stdin and archive entries; anything else passes through.
+func decompress(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !bytes.Equal(magic, gzipMagic) {
+		return buffered, nil
+	}
+	return gzip.NewReader(buffered)
+}
+
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// skipBOM returns a reader over r without its leading UTF-8 byte order mark,
+// if it has one. Windows tools like to start text files with one, and
+// strings.Fields would otherwise glue it to the first word.
+func skipBOM(r io.Reader) (io.Reader, error) {
+	buffered, ok := r.(*bufio.Reader)
+	if !ok {
+		buffered = bufio.NewReader(r)
+	}
+	head, err := buffered.Peek(len(utf8BOM))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if bytes.Equal(head, utf8BOM) {
+		buffered.Discard(len(utf8BOM))
+	}
+	return buffered, nil
+}
+
+// binarySniffLen is how much of a file looksBinary gets to see.
+const binarySniffLen = 8 << 10
+
+// looksBinary reports whether head, the start of a file, is something other
+// than a text message: more than maxRatio of its bytes are NULs, other
+// control characters besides whitespace and ESC (used by ISO-2022 encoded
+// mail), or not valid UTF-8. A single NUL is not enough to go by, as real
+// messages do contain stray ones.
+func looksBinary(head []byte, maxRatio float64) bool {
+	if len(head) == 0 {
+		return false
+	}
+
+	odd := 0
+	for i := 0; i < len(head); {
+		r, size := utf8.DecodeRune(head[i:])
+		switch {
+		case r == '\t', r == '\n', r == '\v', r == '\f', r == '\r', r == 0x1b:
+		case r < 0x20, r == 0x7f, r == utf8.RuneError && size == 1:
+			odd += size
+		}
+		i += size
+	}
+	return float64(odd)/float64(len(head)) > maxRatio
+}
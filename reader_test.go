@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSkipBOM(t *testing.T) {
+	for _, test := range []struct {
+		name, input, want string
+	}{
+		{"bom", "\ufeffFree money", "Free money"},
+		{"no bom", "Free money", "Free money"},
+		{"only bom", "\ufeff", ""},
+		{"empty", "", ""},
+		{"short", "F", "F"},
+		{"bom later", "Free\ufeff money", "Free\ufeff money"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := skipBOM(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("skipBOM(%q) reads %q, want %q", test.input, got, test.want)
+			}
+		})
+	}
+}
+
+func TestTrainFileWithBOM(t *testing.T) {
+	path := writeFile(t, "bom.txt", "\ufeffFree money now")
+	c := NewClassifier()
+	c.MinWordFreq = 1
+	if err := c.TrainFiles([]string{path}, Spam); err != nil {
+		t.Fatal(err)
+	}
+	if c.Bows[Spam]["free"] != 1 {
+		t.Errorf("spam words are %v, want free without the byte order mark", c.Bows[Spam])
+	}
+	for word := range c.Bows[Spam] {
+		if strings.ContainsRune(word, '\ufeff') {
+			t.Errorf("token %q kept the byte order mark", word)
+		}
+	}
+}
+
+// writeGzip writes content gzip-compressed to the file name in dir and
+// returns its path.
+func writeGzip(t testing.TB, dir string, name string, content string) string {
+	t.Helper()
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	if _, err := w.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, compressed.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestGzipFiles(t *testing.T) {
+	const message = "Free money, click here now"
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "message.txt")
+	if err := os.WriteFile(plain, []byte(message), 0644); err != nil {
+		t.Fatal(err)
+	}
+	compressed := writeGzip(t, dir, "message.txt.gz", message)
+
+	train := func(path string) *Classifier {
+		c := NewClassifier()
+		c.MinWordFreq = 1
+		if err := c.TrainFiles([]string{path}, Spam); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	if fromPlain, fromGzip := train(plain), train(compressed); !maps.Equal(fromGzip.Bows[Spam], fromPlain.Bows[Spam]) {
+		t.Errorf("trained %v from the gzip file, want %v", fromGzip.Bows[Spam], fromPlain.Bows[Spam])
+	}
+
+	c := trainedClassifier(t)
+	spamPlain, hamPlain, err := c.ClassifyFile(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spamGzip, hamGzip, err := c.ClassifyFile(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spamGzip != spamPlain || hamGzip != hamPlain {
+		t.Errorf("gzip file scored %v, %v; plain file %v, %v", spamGzip, hamGzip, spamPlain, hamPlain)
+	}
+}
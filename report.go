@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Summary counts the labels of a classification run. Labels counts those of
+// a Classifier with classes other than ham and spam.
+type Summary struct {
+	Spam   int            `json:"spam"`
+	Ham    int            `json:"ham"`
+	Unsure int            `json:"unsure,omitempty"`
+	Labels map[string]int `json:"labels,omitempty"`
+	Total  int            `json:"total"`
+}
+
+func summarize(results []FileResult) Summary {
+	var s Summary
+	for _, result := range results {
+		switch result.Label {
+		case Spam:
+			s.Spam++
+		case Ham:
+			s.Ham++
+		case Unsure:
+			s.Unsure++
+		default:
+			if s.Labels == nil {
+				s.Labels = make(map[string]int)
+			}
+			s.Labels[result.Label]++
+		}
+	}
+	s.Total = len(results)
+	return s
+}
+
+func (s Summary) print() {
+	fmt.Printf("spam: %d \n ham: %d \n", s.Spam, s.Ham)
+	if s.Unsure > 0 {
+		fmt.Printf("unsure: %d \n", s.Unsure)
+	}
+	labels := make([]string, 0, len(s.Labels))
+	for label := range s.Labels {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		fmt.Printf("%s: %d \n", label, s.Labels[label])
+	}
+}
+
+// classifyReport is what the classify subcommand prints. Text output is
+// written as results come in; JSON output is buffered and written as a single
+// {"results": [...], "summary": {...}} document at the end, so it stays valid
+// when piped.
+type classifyReport struct {
+	json    bool
+	results []FileResult
+}
+
+func (r *classifyReport) section(title string) {
+	if !r.json {
+		fmt.Printf(">> classify %s <<\n", title)
+	}
+}
+
+// addFile records the result of a single file; text output shows its label
+// and spam probability.
+func (r *classifyReport) addFile(result FileResult) {
+	r.results = append(r.results, result)
+	if !r.json {
+		fmt.Printf("%s %.2f\n", result.Label, result.Probability)
+		warnUncovered(result)
+	}
+}
+
+// addMessage records the result of one mbox message; text output prefixes the
+// line with the message's path#N.
+func (r *classifyReport) addMessage(result FileResult) {
+	r.results = append(r.results, result)
+	if !r.json {
+		fmt.Printf("%s %s %.2f\n", result.Path, result.Label, result.Probability)
+		warnUncovered(result)
+	}
+}
+
+// warnUncovered warns that a message was labeled by the priors alone
+// because none of its tokens is known to the model.
+func warnUncovered(result FileResult) {
+	if result.Matched == 0 {
+		fmt.Fprintf(os.Stderr, "WARNING: none of the %d tokens of %s is known to the model; it is labeled by the prior alone\n", result.Ignored, result.Path)
+	}
+}
+
+// addDir records the results of a directory, which text output only counts.
+func (r *classifyReport) addDir(results []FileResult) {
+	r.results = append(r.results, results...)
+	r.counts(results)
+}
+
+func (r *classifyReport) counts(results []FileResult) {
+	if !r.json {
+		summarize(results).print()
+	}
+}
+
+func (r *classifyReport) finish() error {
+	if !r.json {
+		return nil
+	}
+
+	results := r.results
+	if results == nil {
+		results = []FileResult{}
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		Results []FileResult `json:"results"`
+		Summary Summary      `json:"summary"`
+	}{results, summarize(r.results)})
+}
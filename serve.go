@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// server answers classification requests over HTTP. The classifier is set
+// once its model has loaded; until then every request gets a 503, so the
+// listener can come up (and health checks can see it) while a large model
+// is still being read.
+type server struct {
+	classifier atomic.Pointer[Classifier]
+
+	// maxBatch is the most messages one POST /classify/batch may hold, and
+	// maxBatchBytes the most bytes its body may take up.
+	maxBatch      int
+	maxBatchBytes int64
+
+	// metrics, when set, is served at /metrics.
+	metrics *serverMetrics
+}
+
+// DefaultMaxBatch is the default limit on the messages of one batch request.
+const DefaultMaxBatch = 1000
+
+// DefaultMaxBatchBytes is the default limit on the body of one batch
+// request. It bounds the memory a single request can tie up, whatever its
+// number of messages.
+const DefaultMaxBatchBytes = 32 << 20
+
+type classifyResponse struct {
+	Label string  `json:"label"`
+	PSpam float64 `json:"pSpam"`
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/classify", s.handleClassify)
+	mux.HandleFunc("/classify/batch", s.handleClassifyBatch)
+	if s.metrics != nil {
+		mux.Handle("/metrics", s.metrics)
+	}
+	return mux
+}
+
+// loadedClassifier returns the classifier for a POST request, or writes the
+// error response and returns nil.
+func (s *server) loadedClassifier(w http.ResponseWriter, r *http.Request) *Classifier {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return nil
+	}
+	classifier := s.classifier.Load()
+	if classifier == nil {
+		http.Error(w, "model is still loading", http.StatusServiceUnavailable)
+	}
+	return classifier
+}
+
+// classify is classifier.ClassifyText, recorded in the metrics.
+func (s *server) classify(classifier *Classifier, message string) (string, float64, error) {
+	start := time.Now()
+	label, pSpam, err := classifier.ClassifyText(message)
+	if err == nil {
+		s.metrics.observe(label, time.Since(start))
+	}
+	return label, pSpam, err
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// handleClassify labels the raw message in the request body.
+func (s *server) handleClassify(w http.ResponseWriter, r *http.Request) {
+	classifier := s.loadedClassifier(w, r)
+	if classifier == nil {
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, DefaultMaxFileSize))
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case len(body) == 0:
+		http.Error(w, "empty message", http.StatusBadRequest)
+		return
+	}
+
+	label, pSpam, err := s.classify(classifier, string(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, classifyResponse{Label: label, PSpam: pSpam})
+}
+
+// handleClassifyBatch labels every message of a JSON array of strings and
+// answers with the results in the same order, classifying them in parallel
+// on the classifier's Workers.
+func (s *server) handleClassifyBatch(w http.ResponseWriter, r *http.Request) {
+	classifier := s.loadedClassifier(w, r)
+	if classifier == nil {
+		return
+	}
+
+	var messages []string
+	body := http.MaxBytesReader(w, r.Body, s.maxBatchBytes)
+	err := json.NewDecoder(body).Decode(&messages)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		http.Error(w, "want a JSON array of messages: "+err.Error(), http.StatusBadRequest)
+		return
+	case len(messages) > s.maxBatch:
+		http.Error(w, fmt.Sprintf("batch of %d messages is over the limit of %d", len(messages), s.maxBatch), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	responses := make([]classifyResponse, len(messages))
+	err = parallelFor(r.Context(), len(messages), classifier.workers(), func(_ int, i int) error {
+		label, pSpam, err := s.classify(classifier, messages[i])
+		if err != nil {
+			return fmt.Errorf("message %d: %w", i, err)
+		}
+		responses[i] = classifyResponse{Label: label, PSpam: pSpam}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, responses)
+}
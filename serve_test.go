@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClassifyBatchLimits(t *testing.T) {
+	srv := &server{maxBatch: 3, maxBatchBytes: 1 << 10}
+	srv.classifier.Store(trainedClassifier(t))
+
+	post := func(body string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		srv.handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/classify/batch", strings.NewReader(body)))
+		return w
+	}
+	batch := func(messages ...string) string {
+		t.Helper()
+		body, err := json.Marshal(messages)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+
+	w := post(batch("free money now", "meeting tomorrow"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("small batch got %d: %s", w.Code, w.Body)
+	}
+	var responses []classifyResponse
+	if err := json.NewDecoder(w.Body).Decode(&responses); err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 2 || responses[0].Label != Spam || responses[1].Label != Ham {
+		t.Errorf("small batch got %+v, want spam then ham", responses)
+	}
+
+	// Two messages, but more bytes than the body may hold.
+	if w := post(batch(strings.Repeat("free ", 150), strings.Repeat("money ", 100))); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body got %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+	if w := post(batch("a", "b", "c", "d")); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("four messages got %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+// ClassStats describes the training messages of one class.
+type ClassStats struct {
+	Label string `json:"label"`
+	Docs  int    `json:"docs"`
+
+	// Tokens is the sum of the class's word counts, or for Bernoulli models
+	// of its document frequencies.
+	Tokens int `json:"tokens"`
+
+	// Vocabulary counts the distinct words of the class and Counted those of
+	// them that pass MinWordFreq, i.e. that scoring looks at.
+	Vocabulary int `json:"vocabulary"`
+	Counted    int `json:"counted"`
+}
+
+// CorpusStats describes what a Classifier has been trained on.
+type CorpusStats struct {
+	Classes     []ClassStats `json:"classes"`
+	Vocabulary  int          `json:"vocabulary"`
+	Counted     int          `json:"counted"`
+	MinWordFreq int          `json:"minWordFreq"`
+}
+
+// Stats reports the size of every class and how much of its vocabulary
+// survives MinWordFreq, e.g. to notice a cutoff so high that one class has no
+// words left and everything is labeled as the other.
+func (c *Classifier) Stats() CorpusStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	stats := CorpusStats{Counted: c.VocabSize, MinWordFreq: c.MinWordFreq}
+	view := c.wordView()
+	words := make(map[string]bool)
+	for _, label := range c.labels() {
+		class := ClassStats{Label: label, Docs: c.Docs[label], Vocabulary: len(view.Bows[label])}
+		for word, count := range view.Bows[label] {
+			class.Tokens += count
+			if view.wordCount(word) >= c.MinWordFreq {
+				class.Counted++
+			}
+			words[word] = true
+		}
+		stats.Classes = append(stats.Classes, class)
+	}
+	stats.Vocabulary = len(words)
+	return stats
+}
@@ -0,0 +1,46 @@
+package main
+
+// countStore is what training and scoring need from the word counts of a
+// class or from DocFreq. Bow, an in-memory map, is the store the Classifier
+// uses; a store on disk, e.g. in a key-value database for a vocabulary that
+// does not fit in memory, would implement the same methods and leave
+// AddDocument and the Classify methods unchanged. BenchmarkCountStore shows
+// what going through the interface costs over using the map directly.
+type countStore interface {
+	// count is how often word was counted, 0 if never.
+	count(word string) int
+
+	// add adds n, which may be negative, to the count of word. A count
+	// that drops to zero or below is removed, so removing a message never
+	// leaves negative counts behind.
+	add(word string, n int)
+
+	// size is the number of distinct words counted.
+	size() int
+
+	// merge adds every count of from, a store of the same kind, e.g. the
+	// counts one training worker collected.
+	merge(from countStore)
+}
+
+func (b Bow) count(word string) int {
+	return b[word]
+}
+
+func (b Bow) add(word string, n int) {
+	if b[word]+n <= 0 {
+		delete(b, word)
+		return
+	}
+	b[word] += n
+}
+
+func (b Bow) size() int {
+	return len(b)
+}
+
+func (b Bow) merge(from countStore) {
+	for word, count := range from.(Bow) {
+		b.add(word, count)
+	}
+}
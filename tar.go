@@ -0,0 +1,74 @@
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"os"
+)
+
+// eachTarMessage calls fn with the name and contents of every regular file in
+// the tar archive read from r, which may be gzip-compressed (.tar.gz).
+// Directories, links and other special entries are skipped.
+func eachTarMessage(r io.Reader, fn func(name string, msg io.Reader) error) error {
+	r, err := decompress(r)
+	if err != nil {
+		return err
+	}
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(header.Name, archive); err != nil {
+			return err
+		}
+	}
+}
+
+// TrainTar adds every file of the tar archive at path to the Bow of label.
+func (c *Classifier) TrainTar(path string, label string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bow, err := c.bowFor(label)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	messages := 0
+	err = eachTarMessage(f, func(name string, msg io.Reader) error {
+		added, err := c.addTrainingReader(msg, bow, c.docFreq())
+		if err != nil {
+			return withPath(name, err)
+		}
+		if !added {
+			return nil
+		}
+		c.countDocs(label, 1)
+		messages++
+		return nil
+	})
+	if err != nil {
+		// Entries read before the error stay in the Bows.
+		c.updateTotals()
+		return err
+	}
+
+	c.updateTotals()
+	c.logger().Info("trained", "tar", path, "label", label, "messages", messages)
+	return nil
+}
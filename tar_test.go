@@ -0,0 +1,126 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tarEntry is a member of a test archive: a regular file holding body, or
+// with typeflag a directory or a symlink to body.
+type tarEntry struct {
+	name     string
+	body     string
+	typeflag byte
+}
+
+// tarArchive returns the bytes of a tar archive of entries.
+func tarArchive(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+	var archive bytes.Buffer
+	w := tar.NewWriter(&archive)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Typeflag: entry.typeflag}
+		switch entry.typeflag {
+		case tar.TypeDir:
+			header.Mode = 0755
+		case tar.TypeSymlink:
+			header.Linkname = entry.body
+		default:
+			header.Typeflag = tar.TypeReg
+			header.Size = int64(len(entry.body))
+		}
+		if err := w.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := w.Write([]byte(entry.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return archive.Bytes()
+}
+
+func TestTrainTar(t *testing.T) {
+	dir := t.TempDir()
+	spamPath := filepath.Join(dir, "spam.tar")
+	spam := tarArchive(t, []tarEntry{
+		{name: "spam/", typeflag: tar.TypeDir},
+		{name: "spam/a.txt", body: "free money now"},
+		{name: "spam/b.txt", body: "cheap pills free shipping"},
+		{name: "spam/c.txt", body: "c.txt", typeflag: tar.TypeSymlink},
+	})
+	if err := os.WriteFile(spamPath, spam, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The ham archive is gzip-compressed.
+	ham := tarArchive(t, []tarEntry{
+		{name: "ham/", typeflag: tar.TypeDir},
+		{name: "ham/a.txt", body: "meeting notes for tomorrow"},
+	})
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write(ham); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	hamPath := filepath.Join(dir, "ham.tar.gz")
+	if err := os.WriteFile(hamPath, compressed.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClassifier()
+	c.MinWordFreq = 1
+	if err := c.TrainTar(spamPath, Spam); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.TrainTar(hamPath, Ham); err != nil {
+		t.Fatal(err)
+	}
+	if c.Docs[Spam] != 2 || c.Docs[Ham] != 1 {
+		t.Errorf("trained %v messages, want 2 spam and 1 ham", c.Docs)
+	}
+	for label, want := range map[string]map[string]int{
+		Spam: {"free": 2, "money": 1, "pills": 1, "c.txt": 0},
+		Ham:  {"meeting": 1, "tomorrow": 1, "free": 0},
+	} {
+		for word, n := range want {
+			if got := c.Bows[label][word]; got != n {
+				t.Errorf("%s counts %s %d times, want %d", label, word, got, n)
+			}
+		}
+	}
+	checkTotals(t, c)
+}
+
+func TestTrainTarKeepsTotalsOnError(t *testing.T) {
+	archive := tarArchive(t, []tarEntry{
+		{name: "msg.txt", body: "free money now"},
+		{name: "msg.txt", body: "cheap pills free shipping"},
+	})
+
+	// Cut the archive off in the middle of the second entry's contents.
+	path := filepath.Join(t.TempDir(), "spam.tar")
+	if err := os.WriteFile(path, archive[:3*512+4], 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := NewClassifier()
+	c.MinWordFreq = 1
+	if err := c.TrainTar(path, Spam); err == nil {
+		t.Fatal("TrainTar read a truncated archive")
+	}
+	if c.Docs[Spam] != 1 {
+		t.Errorf("trained %d messages before the bad one, want 1", c.Docs[Spam])
+	}
+	checkTotals(t, c)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Casing selects how tokens are case-folded.
+type Casing string
+
+const (
+	CaseLower    Casing = "lower"
+	CaseUpper    Casing = "upper"
+	CasePreserve Casing = "preserve"
+)
+
+func parseCasing(s string) (Casing, error) {
+	switch casing := Casing(s); casing {
+	case CaseLower, CaseUpper, CasePreserve:
+		return casing, nil
+	default:
+		return "", fmt.Errorf("unknown casing %q (want lower, upper or preserve)", s)
+	}
+}
+
+// Tokenizer holds the options that decide how text is turned into tokens.
+// Training and classification have to agree on them, so they are saved with
+// the model.
+type Tokenizer struct {
+	Casing Casing
+
+	// NGram is the longest run of adjacent words emitted as a single feature
+	// next to the words themselves; 2 adds bigrams like "click_here". 0 and 1
+	// both mean plain words only.
+	NGram int
+
+	// StopWords are dropped after case folding, before n-grams are built.
+	StopWords map[string]bool
+
+	// Stem reduces words to their Porter stem so "connected" and
+	// "connecting" both count as "connect".
+	Stem bool
+
+	// MinLength and MaxLength bound the length of a word in runes; words
+	// outside the range are dropped. A MaxLength of 0 means no upper bound.
+	MinLength int
+	MaxLength int
+
+	// Normalize applies NFKC-style normalization before case folding, so
+	// look-alikes such as fullwidth or mathematical letters match the plain
+	// word. StripMarks additionally removes accents ("ḟree" -> "free").
+	Normalize  bool
+	StripMarks bool
+
+	// Numbers replaces every number-like word (prices, phone numbers, dates,
+	// order numbers) with NumberToken. Each of those is nearly unique and
+	// never reaches MinWordFreq on its own, but together they tell whether a
+	// message is full of figures.
+	Numbers bool
+
+	// Links replaces a word containing a URL with "<URL:host>", keeping only
+	// its lowercase host, and one containing an email address with
+	// EmailToken. Spam is link-heavy, and the full URLs are as unique as
+	// the numbers above.
+	Links bool
+
+	// CharNGram, when positive, replaces words with the runs of CharNGram
+	// characters of the whole message once whitespace and punctuation are
+	// removed, so "f r e e", "f.r.e.e" and "free" all yield "fre" and "ree".
+	// That survives the word splitting spammers use to dodge word filters.
+	// The word options other than Casing and Normalize do not apply.
+	CharNGram int
+}
+
+// NumberToken is the token number-like words become with Tokenizer.Numbers.
+const NumberToken = "<NUM>"
+
+// NGramSeparator joins the words of an n-gram feature.
+const NGramSeparator = "_"
+
+func DefaultTokenizer() Tokenizer {
+	return Tokenizer{
+		Casing:    CaseLower,
+		NGram:     1,
+		MinLength: 2,
+		Normalize: true,
+	}
+}
+
+// Tokenize splits message on whitespace and case-folds each token. Leading and
+// trailing punctuation is trimmed so "free!", "(free" and "free" are the same
+// token, while inner punctuation as in "e-mail" or "won't" is kept.
+func (t Tokenizer) Tokenize(message string) []string {
+	if t.Normalize || t.StripMarks {
+		message = normalizeText(message, t.StripMarks)
+	}
+
+	var tokens []string
+	if t.CharNGram > 0 {
+		grams := charGrams{n: t.CharNGram, fn: func(gram string) { tokens = append(tokens, gram) }}
+		grams.add(t.fold(message))
+		return tokens
+	}
+	for _, field := range strings.Fields(message) {
+		if token, ok := t.word(field); ok {
+			tokens = append(tokens, token)
+		}
+	}
+	return t.addNGrams(tokens)
+}
+
+// TokenizeReader is Tokenize for a message read incrementally from r, so a
+// large message is never held in memory as a whole. It calls fn with the same
+// tokens Tokenize would return, though not in the same order, except that
+// words too long for a bufio.Scanner are cut into pieces (see scanLongWords).
+func (t Tokenizer) TokenizeReader(r io.Reader, fn func(token string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(scanLongWords)
+
+	// window holds the last NGram-1 words for the n-grams ending at the
+	// next one.
+	window := make([]string, 0, t.NGram)
+	grams := charGrams{n: t.CharNGram, fn: fn}
+	for scanner.Scan() {
+		field := scanner.Text()
+		if t.Normalize || t.StripMarks {
+			field = normalizeText(field, t.StripMarks)
+		}
+		if t.CharNGram > 0 {
+			grams.add(t.fold(field))
+			continue
+		}
+		for _, field := range strings.Fields(field) {
+			token, ok := t.word(field)
+			if !ok {
+				continue
+			}
+
+			fn(token)
+			if t.NGram < 2 {
+				continue
+			}
+			if len(window) == t.NGram {
+				window = append(window[:0], window[1:]...)
+			}
+			window = append(window, token)
+			for n := 2; n <= len(window); n++ {
+				fn(strings.Join(window[len(window)-n:], NGramSeparator))
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// charGrams emits the character n-grams of text fed to it piece by piece,
+// skipping whitespace and punctuation, so the n-grams run across the pieces.
+type charGrams struct {
+	n      int
+	window []rune
+	fn     func(gram string)
+}
+
+func (g *charGrams) add(text string) {
+	for _, r := range text {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) {
+			continue
+		}
+		if len(g.window) == g.n {
+			g.window = append(g.window[:0], g.window[1:]...)
+		}
+		g.window = append(g.window, r)
+		if len(g.window) == g.n {
+			g.fn(string(g.window))
+		}
+	}
+}
+
+// scanLongWords is bufio.ScanWords, except that a word too long for the
+// scanner's buffer (say, a line of base64) is cut into buffer-sized pieces
+// instead of failing the scan.
+func scanLongWords(data []byte, atEOF bool) (int, []byte, error) {
+	advance, token, err := bufio.ScanWords(data, atEOF)
+	if advance == 0 && token == nil && err == nil && len(data) >= bufio.MaxScanTokenSize {
+		return len(data), data, nil
+	}
+	return advance, token, err
+}
+
+// word turns one whitespace-separated field into a token, reporting false
+// when the field is dropped.
+func (t Tokenizer) word(field string) (string, bool) {
+	token := strings.TrimFunc(field, unicode.IsPunct)
+	if token == "" {
+		return "", false
+	}
+	if t.Links {
+		if feature, ok := linkFeature(token); ok {
+			return feature, true
+		}
+	}
+	if t.Numbers && isNumber(token) {
+		return NumberToken, true
+	}
+	token = t.fold(token)
+	if t.StopWords[token] {
+		return "", false
+	}
+	if t.Stem {
+		token = t.stem(token)
+		if token == "" {
+			return "", false
+		}
+	}
+	if !t.lengthOK(token) {
+		return "", false
+	}
+	return token, true
+}
+
+// isNumber reports whether token is made of digits, possibly with the
+// separators, signs and currency symbols of "$19.99", "555-1234", "10%" or
+// "2004/08/01", but no letters.
+func isNumber(token string) bool {
+	digits := false
+	for _, r := range token {
+		switch {
+		case unicode.IsDigit(r):
+			digits = true
+		case strings.ContainsRune(".,:-+/%#", r), unicode.Is(unicode.Sc, r):
+		default:
+			return false
+		}
+	}
+	return digits
+}
+
+// stem runs the Porter stemmer on the lowercase form of an already folded
+// token and folds the result back, so the stem keeps the token's casing.
+func (t Tokenizer) stem(token string) string {
+	lower := strings.ToLower(token)
+	stemmed := porterStem(lower)
+	if token == lower {
+		return stemmed
+	}
+	if token == strings.ToUpper(token) {
+		return strings.ToUpper(stemmed)
+	}
+	// A mixed-case token under CasePreserve; keep its original form if the
+	// stem didn't change anything.
+	if stemmed == lower {
+		return token
+	}
+	return stemmed
+}
+
+func (t Tokenizer) addNGrams(words []string) []string {
+	tokens := words
+	for n := 2; n <= t.NGram; n++ {
+		for i := 0; i+n <= len(words); i++ {
+			tokens = append(tokens, strings.Join(words[i:i+n], NGramSeparator))
+		}
+	}
+	return tokens
+}
+
+func (t Tokenizer) lengthOK(token string) bool {
+	length := utf8.RuneCountInString(token)
+	return length >= t.MinLength && (t.MaxLength == 0 || length <= t.MaxLength)
+}
+
+func (t Tokenizer) fold(token string) string {
+	switch t.Casing {
+	case CaseUpper:
+		return strings.ToUpper(token)
+	case CasePreserve:
+		return token
+	default:
+		return strings.ToLower(token)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+// sampleMessage is a typical enron spam message of about 1KB.
+const sampleMessage = "data/enron1/spam/0006.2003-12-18.GP.spam.txt"
+
+func BenchmarkTokenize(b *testing.B) {
+	content, err := os.ReadFile(sampleMessage)
+	if err != nil {
+		b.Fatal(err)
+	}
+	message := string(content)
+	tokenizer := DefaultTokenizer()
+	b.SetBytes(int64(len(content)))
+	b.ReportAllocs()
+	for b.Loop() {
+		tokenizer.Tokenize(message)
+	}
+}
+
+// dataSeeds are messages from the corpus the fuzz targets start from.
+var dataSeeds = []string{
+	sampleMessage,
+	"data/enron1/ham/0001.1999-12-10.farmer.ham.txt",
+	"data/enron1/ham/0002.1999-12-13.farmer.ham.txt",
+}
+
+func addDataSeeds(f *testing.F) {
+	for _, path := range dataSeeds {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(content)
+	}
+}
+
+func FuzzTokenize(f *testing.F) {
+	addDataSeeds(f)
+	f.Add([]byte("\ufeffSubject: free\x00money\x1b[0m now!!!"))
+	f.Add([]byte("ＦＲＥＥ ﬁnance café́ \u200bclick here"))
+	f.Add([]byte(strings.Repeat("a", bufio.MaxScanTokenSize+10) + " b"))
+	f.Add([]byte("\xff\xfe bad \xc3( utf-8 -- ... \"quoted\" (paren) —dash—"))
+
+	tokenizer := DefaultTokenizer()
+	f.Fuzz(func(t *testing.T, message []byte) {
+		tokens := tokenizer.Tokenize(string(message))
+		for _, token := range tokens {
+			if token == "" {
+				t.Fatalf("empty token from %q", message)
+			}
+			if strings.IndexFunc(token, unicode.IsSpace) >= 0 {
+				t.Fatalf("token %q holds whitespace", token)
+			}
+			if token != strings.ToLower(token) {
+				t.Fatalf("token %q is not lower case", token)
+			}
+			if utf8.RuneCountInString(token) < tokenizer.MinLength {
+				t.Fatalf("token %q is shorter than %d", token, tokenizer.MinLength)
+			}
+		}
+
+		// TokenizeReader promises the same tokens, in any order, for words
+		// that fit its buffer.
+		for _, field := range bytes.Fields(message) {
+			if len(field) >= bufio.MaxScanTokenSize {
+				return
+			}
+		}
+		counts := make(map[string]int)
+		for _, token := range tokens {
+			counts[token]++
+		}
+		err := tokenizer.TokenizeReader(bytes.NewReader(message), func(token string) { counts[token]-- })
+		if err != nil {
+			t.Fatal(err)
+		}
+		for token, count := range counts {
+			if count != 0 {
+				t.Fatalf("TokenizeReader and Tokenize disagree on %q by %d in %q", token, count, message)
+			}
+		}
+	})
+}
+
+func TestTokenizePunctuation(t *testing.T) {
+	tokenizer := DefaultTokenizer()
+	for _, test := range []struct {
+		name    string
+		message string
+		want    []string
+	}{
+		{"trailing", "free! free, free.", []string{"free", "free", "free"}},
+		{"quotes", `"free" 'free' “free” «free»`, []string{"free", "free", "free", "free"}},
+		{"parentheses", "(free) [money] {now}", []string{"free", "money", "now"}},
+		{"em-dashes", "free — now —later—", []string{"free", "now", "later"}},
+		{"only punctuation", "... !! -- —", nil},
+		{"inner punctuation", "e-mail won't (u.s.a.)", []string{"e-mail", "won't", "u.s.a"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := tokenizer.Tokenize(test.message); !slices.Equal(got, test.want) {
+				t.Errorf("Tokenize(%q) = %q, want %q", test.message, got, test.want)
+			}
+		})
+	}
+}
+
+func TestTokenizeBigrams(t *testing.T) {
+	tokenizer := DefaultTokenizer()
+	tokenizer.NGram = 2
+	tokens := tokenizer.Tokenize("CLICK HERE")
+	if !slices.Contains(tokens, "click_here") {
+		t.Errorf("Tokenize(\"CLICK HERE\") = %q, want the bigram click_here", tokens)
+	}
+	if slices.Contains(tokenizer.Tokenize("CLICK or HERE"), "click_here") {
+		t.Error("click_here emitted for words that are not adjacent")
+	}
+
+	// The bigram is a feature of its own, so a model tells the phrase from
+	// its words.
+	c := NewClassifier()
+	c.MinWordFreq = 1
+	c.Tokenizer = tokenizer
+	if err := c.AddDocument("click here", Spam); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddDocument("here click", Ham); err != nil {
+		t.Fatal(err)
+	}
+	for word, want := range map[string]int{"click": 2, "here": 2, "click_here": 1, "here_click": 1} {
+		if got := c.wordCount(word); got != want {
+			t.Errorf("%s counted %d times, want %d", word, got, want)
+		}
+	}
+}
+
+func TestTokenizeCharNGrams(t *testing.T) {
+	tokenizer := DefaultTokenizer()
+	tokenizer.CharNGram = 3
+	want := []string{"fre", "ree"}
+	for _, message := range []string{"free", "f r e e", "f.r.e.e", "F-R-E-E!", "fr ee"} {
+		if got := tokenizer.Tokenize(message); !slices.Equal(got, want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", message, got, want)
+		}
+		var streamed []string
+		if err := tokenizer.TokenizeReader(strings.NewReader(message), func(gram string) { streamed = append(streamed, gram) }); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(streamed, want) {
+			t.Errorf("TokenizeReader(%q) gave %q, want %q", message, streamed, want)
+		}
+	}
+}
+
+func TestStemCollapsesWordFamilies(t *testing.T) {
+	tokenizer := DefaultTokenizer()
+	tokenizer.Stem = true
+	for stem, family := range map[string][]string{
+		"win":     {"win", "wins", "winning"},
+		"connect": {"connect", "connected", "connecting", "connection", "connections"},
+		"offer":   {"offer", "offers", "offered", "offering"},
+	} {
+		for _, word := range family {
+			if got := tokenizer.Tokenize(word); !slices.Equal(got, []string{stem}) {
+				t.Errorf("Tokenize(%q) = %q, want [%q]", word, got, stem)
+			}
+		}
+	}
+}
+
+func TestTokenizeMixedNGrams(t *testing.T) {
+	want := []string{"click", "here", "now", "click_here", "here_now"}
+	for _, value := range []string{"mixed", "1,2"} {
+		var n ngramFlag
+		if err := n.Set(value); err != nil {
+			t.Fatal(err)
+		}
+		tokenizer := DefaultTokenizer()
+		tokenizer.NGram = int(n)
+		if got := tokenizer.Tokenize("click here now"); !slices.Equal(got, want) {
+			t.Errorf("--ngram %s: Tokenize(\"click here now\") = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestTokenizeUnicodeEvasion(t *testing.T) {
+	tokenizer := DefaultTokenizer()
+	for _, test := range []struct {
+		message string
+		want    string
+	}{
+		{"ＦＲＥＥ", "free"},
+		{"𝐟𝐫𝐞𝐞", "free"},
+		{"fr\u200bee", "free"},
+		{"f\u200dr\u00adee\u2060", "free"},
+		{"\ufeffFREE", "free"},
+		{"ﬁnance", "finance"},
+		{"ｆｉｎａｎｃｅ", "finance"},
+		{"cafe\u0301", "café"},
+	} {
+		if got := tokenizer.Tokenize(test.message); !slices.Equal(got, []string{test.want}) {
+			t.Errorf("Tokenize(%q) = %q, want [%q]", test.message, got, test.want)
+		}
+	}
+
+	tokenizer.StripMarks = true
+	if got := tokenizer.Tokenize("ḟrée café"); !slices.Equal(got, []string{"free", "cafe"}) {
+		t.Errorf("with StripMarks, Tokenize(\"ḟrée café\") = %q, want [free cafe]", got)
+	}
+}
+
+func TestTokenizeLengthBounds(t *testing.T) {
+	tokenizer := DefaultTokenizer()
+	tokenizer.MinLength = 3
+	tokenizer.MaxLength = 6
+	for _, test := range []struct {
+		name string
+		word string
+		kept bool
+	}{
+		{"MinLength-1", "ab", false},
+		{"MinLength", "abc", true},
+		{"MaxLength", "abcdef", true},
+		{"MaxLength+1", "abcdefg", false},
+		// Length is in runes, not bytes, and counted after trimming.
+		{"MaxLength in runes", "éééééé", true},
+		{"MinLength after trimming", "(ab)", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := tokenizer.Tokenize(test.word)
+			if kept := len(got) == 1; kept != test.kept {
+				t.Errorf("Tokenize(%q) = %q, want it kept: %v", test.word, got, test.kept)
+			}
+		})
+	}
+
+	tokenizer.MaxLength = 0
+	if got := tokenizer.Tokenize(strings.Repeat("a", 1000)); len(got) != 1 {
+		t.Errorf("with MaxLength 0, a 1000-letter word gave %d tokens, want 1", len(got))
+	}
+}